@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// WithAdminToken registers the /admin routes, guarded by token. A request
+// must send it as "Authorization: Bearer <token>". Without a token the admin
+// routes are not registered at all.
+func WithAdminToken(token string) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.adminToken = token
+	}
+}
+
+// handleAdmin registers an admin route behind the token check, or answers
+// 404 on it when no admin token is configured
+func (j *JsonOverHTTP) handleAdmin(pattern string, h http.HandlerFunc, endpoints ...string) {
+	if j.adminToken == "" {
+		// a 404 of its own keeps a broader pattern such as /users/ from serving it
+		j.router.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			j.writeError(w, r, "404 page not found", http.StatusNotFound)
+		})
+		return
+	}
+	j.handle(pattern, j.requireAdmin(h), endpoints...)
+}
+
+// requireAdmin answers 401 unless the request carries the admin token
+func (j *JsonOverHTTP) requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(j.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			j.writeError(w, r, "Admin token is missing or wrong", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Reset clears everything but the identity of a user: name, phone and
+// verification. A new verification token is sent out.
+func (us *UserServiceImpl) Reset(ctx context.Context, email string) (err error) {
+	ctx, end := us.startSpan(ctx, "Reset")
+	defer func() { end(err) }()
+
+	token := newVerificationToken()
+
+	_, err = us.userStorage.Update(ctx, email, func(u *User) error {
+		*u = User{
+			ID:        u.ID,
+			Email:     u.Email,
+			CreatedAt: u.CreatedAt,
+			Version:   u.Version + 1,
+
+			VerificationToken: token,
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	us.record(ctx, "reset", email)
+	us.sendToken(ctx, email, token)
+	return nil
+}
+
+// ResetUser handles POST /admin/user/{email}/reset
+func (j *JsonOverHTTP) ResetUser(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimPrefix(r.URL.Path, "/admin/user/")
+	if !strings.HasSuffix(email, "/reset") {
+		j.writeError(w, r, "404 page not found", http.StatusNotFound)
+		return
+	}
+	email = strings.TrimSuffix(email, "/reset")
+
+	if r.Method != http.MethodPost {
+		j.writeError(w, r, "ResetUser requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := j.usrServ.Reset(r.Context(), email)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	u, err := j.usrServ.GetByEmail(r.Context(), email)
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(u))
+	j.writeJSON(w, r, http.StatusOK, u)
+}
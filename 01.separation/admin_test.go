@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "Bearer s3cret"
+
+func TestMaintenanceToggle(t *testing.T) {
+	maint := &Maintenance{}
+	joh, _ := newTestServer(t, WithMaintenance(maint), WithAdminToken("s3cret"))
+	h := maint.Middleware(joh)
+
+	if w := do(h, http.MethodGet, "/", ""); w.Code != http.StatusOK {
+		t.Fatalf("before: got %d", w.Code)
+	}
+
+	w := do(h, http.MethodPost, "/admin/maintenance", `{"enabled":true}`, "Authorization", testAdminToken)
+	if w.Code != http.StatusOK || !maint.Enabled() {
+		t.Fatalf("switching on: got %d %s", w.Code, w.Body)
+	}
+
+	w = do(h, http.MethodPost, "/register", `{"email":"a@example.com", "name":"A"}`)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("register in maintenance: got %d %s, want a JSON 503", w.Code, w.Body)
+	}
+	for _, path := range []string{"/healthz", "/admin/maintenance"} {
+		if w := do(h, http.MethodGet, path, "", "Authorization", testAdminToken); w.Code != http.StatusOK {
+			t.Errorf("GET %s in maintenance: got %d, want 200", path, w.Code)
+		}
+	}
+
+	do(h, http.MethodPost, "/admin/maintenance", `{"enabled":false}`, "Authorization", testAdminToken)
+	if w := do(h, http.MethodPost, "/register", `{"email":"a@example.com", "name":"A"}`); w.Code != http.StatusCreated {
+		t.Errorf("after: got %d, want 201", w.Code)
+	}
+}
+
+func TestResetUser(t *testing.T) {
+	joh, storage := newTestServer(t, WithAdminToken("s3cret"))
+	do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "name":"Alex", "phone":"+84901234567"}`)
+	storage.Update(context.Background(), "a@example.com", func(u *User) error {
+		u.Verified = true
+		return nil
+	})
+	before, _ := storage.Get(context.Background(), "a@example.com")
+
+	if w := do(joh, http.MethodPost, "/admin/user/a@example.com/reset", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: got %d, want 401", w.Code)
+	}
+
+	w := do(joh, http.MethodPost, "/admin/user/a@example.com/reset", "", "Authorization", testAdminToken)
+	var u User
+	if err := json.Unmarshal(w.Body.Bytes(), &u); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if u.Email != "a@example.com" || u.ID != before.ID || u.Name != "" || u.Phone != "" || u.Verified {
+		t.Errorf("got %+v", u)
+	}
+
+	stored, _ := storage.Get(context.Background(), "a@example.com")
+	if stored.VerificationToken == "" || stored.VerificationToken == before.VerificationToken {
+		t.Error("no new verification token")
+	}
+
+	w = do(joh, http.MethodPost, "/admin/user/nobody@example.com/reset", "", "Authorization", testAdminToken)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: got %d, want 404", w.Code)
+	}
+}
+
+func TestAdminRoutesNeedToken(t *testing.T) {
+	joh, _ := newTestServer(t)
+	mustRegister(t, joh, "a@example.com", "A")
+
+	if w := do(joh, http.MethodPost, "/admin/user/a@example.com/reset", ""); w.Code != http.StatusNotFound {
+		t.Errorf("without an admin token: got %d, want 404", w.Code)
+	}
+}
+
+func TestStorageStats(t *testing.T) {
+	joh, _ := newTestServer(t, WithAdminToken("s3cret"))
+	mustRegister(t, joh, "a@example.com", "A")
+	mustRegister(t, joh, "b@example.com", "B")
+
+	w := do(joh, http.MethodGet, "/admin/storage/stats", "", "Authorization", testAdminToken)
+	var stats map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if stats["backend"] != "memory" || stats["users"] != 2.0 || stats["approx_memory_bytes"].(float64) <= 0 {
+		t.Errorf("got %v", stats)
+	}
+
+	// storages without Stats
+	unsupported := NewJSONOverHTTP(NewUserServiceImpl(noListStorage{NewMemoUserStorage()}), WithAdminToken("s3cret"))
+	if w := do(unsupported, http.MethodGet, "/admin/storage/stats", "", "Authorization", testAdminToken); w.Code != http.StatusNotImplemented {
+		t.Errorf("unsupported: got %d, want 501", w.Code)
+	}
+}
+
+func TestFileStorageStats(t *testing.T) {
+	fs, err := NewFileUserStorage(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, _ := fs.Stats()
+	if stats["backend"] != "file" || stats["users"] != 0 || stats["file_size_bytes"] != 0 {
+		t.Errorf("empty: %v", stats)
+	}
+
+	fs.Save(context.Background(), &User{Email: "a@example.com"})
+	stats, _ = fs.Stats()
+	if size, _ := stats["file_size_bytes"].(int64); stats["users"] != 1 || size <= 0 {
+		t.Errorf("after a save: %v", stats)
+	}
+}
+
+func TestRecentLookups(t *testing.T) {
+	joh, _ := newTestServer(t, WithAdminToken("s3cret"), WithRecentLookups(3))
+	for _, email := range []string{"a", "b", "c", "d"} {
+		mustRegister(t, joh, email+"@example.com", email)
+	}
+
+	for _, target := range []string{"/user?email=a@example.com", "/users/b@example.com", "/user?email=c@example.com", "/users/d@example.com", "/user?email=b@example.com"} {
+		do(joh, http.MethodGet, target, "")
+	}
+
+	w := do(joh, http.MethodGet, "/admin/recent-lookups", "", "Authorization", testAdminToken)
+	var recent []Lookup
+	if err := json.Unmarshal(w.Body.Bytes(), &recent); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	var emails []string
+	for _, l := range recent {
+		emails = append(emails, l.Email)
+	}
+	// the oldest two fell out, the rest are oldest first
+	if want := "c@example.com d@example.com b@example.com"; strings.Join(emails, " ") != want {
+		t.Errorf("got %v, want %s", emails, want)
+	}
+}
+
+func TestRecentLookupsRing(t *testing.T) {
+	rl := NewRecentLookups(2)
+	if got := rl.List(); len(got) != 0 {
+		t.Errorf("empty ring: %v", got)
+	}
+
+	now := time.Now()
+	rl.Add("a", now)
+	if got := rl.List(); len(got) != 1 || got[0].Email != "a" {
+		t.Errorf("one lookup: %v", got)
+	}
+
+	// a zero size ring keeps nothing and does not panic
+	zero := NewRecentLookups(0)
+	zero.Add("a", now)
+	if got := zero.List(); len(got) != 0 {
+		t.Errorf("zero size: %v", got)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditLogger records mutating operations for an append-only audit trail
+type AuditLogger interface {
+	Record(ctx context.Context, action, email string, at time.Time) error
+}
+
+// JSONAuditLogger writes one JSON object per line to w
+type JSONAuditLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONAuditLogger ...
+func NewJSONAuditLogger(w io.Writer) *JSONAuditLogger {
+	return &JSONAuditLogger{w: w}
+}
+
+type auditEntry struct {
+	Action string    `json:"action"`
+	Email  string    `json:"email"`
+	At     time.Time `json:"at"`
+}
+
+// Record ...
+func (al *JSONAuditLogger) Record(ctx context.Context, action, email string, at time.Time) error {
+	line, err := json.Marshal(auditEntry{Action: action, Email: email, At: at.UTC()})
+	if err != nil {
+		return err
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	_, err = al.w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestAuditRegisterDelete(t *testing.T) {
+	var buf bytes.Buffer
+	us := NewUserServiceImpl(NewMemoUserStorage(), WithAuditLogger(NewJSONAuditLogger(&buf)))
+	ctx := context.Background()
+
+	if err := us.Register(ctx, &RegisterParams{Email: "a@example.com", Name: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	// a failed mutation is not recorded
+	if err := us.Register(ctx, &RegisterParams{Email: "a@example.com", Name: "A"}); err == nil {
+		t.Fatal("registered the same email twice")
+	}
+	if n, err := us.DeleteMany(ctx, []string{"a@example.com"}); err != nil || n != 1 {
+		t.Fatalf("deleted %d, %v", n, err)
+	}
+
+	var got []auditEntry
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("%s: %v", sc.Text(), err)
+		}
+		got = append(got, e)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(got), got)
+	}
+	for i, action := range []string{"register", "delete"} {
+		if got[i].Action != action || got[i].Email != "a@example.com" || got[i].At.IsZero() {
+			t.Errorf("record %d = %+v, want %s of a@example.com", i, got[i], action)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces the value of every sensitive field in a logged body
+const redacted = "[REDACTED]"
+
+// sensitiveField reports whether a field holds a secret, any name containing
+// password or token such as verification_token
+func sensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "password") || strings.Contains(name, "token")
+}
+
+// sensitiveJSON catches sensitive string fields in bodies that are not valid
+// JSON, where redactJSON cannot be used
+var sensitiveJSON = regexp.MustCompile(`(?i)("[^"]*(?:password|token)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// redactBody returns body with the values of sensitive fields replaced, for
+// JSON and form bodies alike
+func redactBody(body []byte, contentType string) []byte {
+	if mt, _, _ := mime.ParseMediaType(contentType); mt == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(body))
+		if err == nil {
+			for k := range values {
+				if sensitiveField(k) {
+					values[k] = []string{redacted}
+				}
+			}
+			return []byte(values.Encode())
+		}
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return sensitiveJSON.ReplaceAll(body, []byte(`$1"`+redacted+`"`))
+	}
+
+	out, err := json.Marshal(redactJSON(v))
+	if err != nil {
+		return sensitiveJSON.ReplaceAll(body, []byte(`$1"`+redacted+`"`))
+	}
+	return out
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if sensitiveField(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactJSON(v[i])
+		}
+	}
+	return v
+}
+
+// truncateBody cuts body to max bytes, noting how much was left out
+func truncateBody(body []byte, max int) string {
+	if len(body) <= max {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:max], len(body)-max)
+}
+
+// bodyRecorder keeps a copy of everything written to the response
+type bodyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (br *bodyRecorder) Write(b []byte) (int, error) {
+	br.body.Write(b)
+	return br.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (br *bodyRecorder) Unwrap() http.ResponseWriter {
+	return br.ResponseWriter
+}
+
+// BodyLog logs request and response bodies, redacted and cut to max bytes.
+// It reads no more of a request body than maxBody, the most the handlers
+// accept. It is for troubleshooting in dev mode only and is off by default.
+func BodyLog(next http.Handler, logger *log.Logger, max int, maxBody int64) http.Handler {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// read no more than the decoder would accept, the rest is left for it to reject
+		reqBody, _ := io.ReadAll(io.LimitReader(r.Body, maxBody))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), r.Body))
+
+		rec := &bodyRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		id := RequestIDFrom(r.Context())
+		if len(reqBody) > 0 {
+			logger.Printf("DEBUG request_id=%s request body: %s", id, truncateBody(redactBody(reqBody, r.Header.Get("Content-Type")), max))
+		}
+		if rec.body.Len() > 0 {
+			logger.Printf("DEBUG request_id=%s response body: %s", id, truncateBody(redactBody(rec.body.Bytes(), w.Header().Get("Content-Type")), max))
+		}
+	})
+}
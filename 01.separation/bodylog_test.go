@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		body, contentType, want string
+	}{
+		{`{"email":"a@example.com","password":"hunter2"}`, "application/json", `{"email":"a@example.com","password":"[REDACTED]"}`},
+		{`{"user":{"verification_token":"abc"},"list":[{"Token":"x"}]}`, "application/json", `{"list":[{"Token":"[REDACTED]"}],"user":{"verification_token":"[REDACTED]"}}`},
+		{`{"password":"hunter2",`, "application/json", `{"password":"[REDACTED]",`},
+		{"email=a%40example.com&password=hunter2", "application/x-www-form-urlencoded", "email=a%40example.com&password=%5BREDACTED%5D"},
+	}
+	for _, tt := range tests {
+		if got := string(redactBody([]byte(tt.body), tt.contentType)); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestBodyLog(t *testing.T) {
+	var buf bytes.Buffer
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	})
+	h := BodyLog(echo, log.New(&buf, "", 0), 40, 1<<20)
+
+	body := `{"token":"s3cret","name":"` + strings.Repeat("x", 50) + `"}`
+	w := do(h, http.MethodPost, "/", body)
+
+	// the handler still gets the whole body
+	if w.Body.String() != body {
+		t.Errorf("handler saw %s", w.Body)
+	}
+
+	logged := buf.String()
+	if strings.Contains(logged, "s3cret") {
+		t.Errorf("token logged: %s", logged)
+	}
+	if !strings.Contains(logged, "request body: {\"name\":\"xxx") || !strings.Contains(logged, "more bytes)") {
+		t.Errorf("want a redacted, truncated request body: %s", logged)
+	}
+	if !strings.Contains(logged, "response body:") {
+		t.Errorf("response body not logged: %s", logged)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+	"github.com/alexlevn/go_simplest_restapi/textfold"
+)
+
+// DeleteFilter selects users for DeleteMatching
+type DeleteFilter struct {
+	// NameContains matches names ignoring case and accents
+	NameContains string
+}
+
+func (df *DeleteFilter) matches(u *User) bool {
+	return textfold.Contains(u.Name, df.NameContains)
+}
+
+// DeleteMany deletes the given users, skipping the ones that do not exist,
+// and returns how many were deleted
+func (us *UserServiceImpl) DeleteMany(ctx context.Context, emails []string) (deleted int, err error) {
+	ctx, end := us.startSpan(ctx, "DeleteMany")
+	defer func() { end(err) }()
+
+	for _, email := range emails {
+		err = us.userStorage.Delete(ctx, email)
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		} else if err != nil {
+			return deleted, err
+		}
+
+		deleted++
+		us.record(ctx, "delete", email)
+	}
+
+	return deleted, nil
+}
+
+// DeleteMatching deletes every user matching filter. It may return an
+// ErrListUnsupported error.
+func (us *UserServiceImpl) DeleteMatching(ctx context.Context, filter *DeleteFilter) (deleted int, err error) {
+	ctx, end := us.startSpan(ctx, "DeleteMatching")
+	defer func() { end(err) }()
+
+	lister, ok := us.userStorage.(Lister)
+	if !ok {
+		return 0, ErrListUnsupported
+	}
+
+	users, err := lister.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var emails []string
+	for _, u := range users {
+		if filter.matches(u) {
+			emails = append(emails, u.Email)
+		}
+	}
+
+	return us.DeleteMany(ctx, emails)
+}
+
+type bulkDeleteParams struct {
+	Emails       []string `json:"emails"`
+	NameContains string   `json:"name_contains"`
+}
+
+// BulkDeleteUsers handles POST /users/bulk-delete with either an email list or a filter
+func (j *JsonOverHTTP) BulkDeleteUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		j.writeError(w, r, "BulkDeleteUsers requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if j.lockedOut(w, r) {
+		return
+	}
+
+	params := &bulkDeleteParams{}
+	err := jsonbody.Decode(w, r, params, j.bodyLimits)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	if (len(params.Emails) == 0) == (params.NameContains == "") {
+		j.writeError(w, r, "Give either emails or name_contains", http.StatusBadRequest)
+		return
+	}
+
+	var deleted int
+	if len(params.Emails) > 0 {
+		deleted, err = j.usrServ.DeleteMany(r.Context(), params.Emails)
+	} else {
+		deleted, err = j.usrServ.DeleteMatching(r.Context(), &DeleteFilter{NameContains: params.NameContains})
+	}
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	if deleted < len(params.Emails) {
+		// the count tells the client some of the emails were unknown
+		j.failLookup(r)
+	}
+	j.writeJSON(w, r, http.StatusOK, map[string]int{"deleted": deleted})
+}
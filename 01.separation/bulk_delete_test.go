@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBulkDeleteUsers(t *testing.T) {
+	joh, storage := newTestServer(t, WithAdminToken("s3cret"))
+	for _, u := range [][2]string{
+		{"a@example.com", "Test A"},
+		{"b@example.com", "Tést B"},
+		{"c@example.com", "Lan"},
+		{"d@example.com", "Minh"},
+	} {
+		mustRegister(t, joh, u[0], u[1])
+	}
+
+	tests := []struct {
+		body    string
+		want    string
+		removed []string
+	}{
+		{`{"emails":["d@example.com","nobody@example.com"]}`, `{"deleted":1}`, []string{"d@example.com"}},
+		{`{"name_contains":"test"}`, `{"deleted":2}`, []string{"a@example.com", "b@example.com"}},
+	}
+	for _, tt := range tests {
+		w := do(joh, http.MethodPost, "/users/bulk-delete", tt.body, "Authorization", "Bearer s3cret")
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != tt.want {
+			t.Errorf("%s: got %d %s, want %s", tt.body, w.Code, w.Body, tt.want)
+		}
+		for _, email := range tt.removed {
+			if _, err := storage.Get(context.Background(), email); err == nil {
+				t.Errorf("%s: %s is still there", tt.body, email)
+			}
+		}
+	}
+
+	if _, err := storage.Get(context.Background(), "c@example.com"); err != nil {
+		t.Errorf("c@example.com was deleted too: %v", err)
+	}
+
+	for _, body := range []string{`{}`, `{"emails":["c@example.com"],"name_contains":"Lan"}`} {
+		if w := do(joh, http.MethodPost, "/users/bulk-delete", body, "Authorization", "Bearer s3cret"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestBulkDeleteUsersAdminOnly(t *testing.T) {
+	joh, storage := newTestServer(t, WithAdminToken("s3cret"))
+	mustRegister(t, joh, "a@example.com", "Test A")
+
+	for _, header := range [][]string{nil, {"Authorization", "Bearer wrong"}} {
+		w := do(joh, http.MethodPost, "/users/bulk-delete", `{"name_contains":"test"}`, header...)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%v: got %d %s, want 401", header, w.Code, w.Body)
+		}
+	}
+	if _, err := storage.Get(context.Background(), "a@example.com"); err != nil {
+		t.Errorf("a@example.com was deleted: %v", err)
+	}
+
+	// without an admin token the route does not exist
+	none, _ := newTestServer(t)
+	if w := do(none, http.MethodPost, "/users/bulk-delete", `{"name_contains":"test"}`); w.Code != http.StatusNotFound {
+		t.Errorf("no admin token: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,172 @@
+// Package client talks to the JSON over HTTP user server
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrEmailExist is returned when registering an email that is already taken
+var ErrEmailExist = errors.New("Email is already in user")
+
+// ErrUserNotFound is returned when no user matches the requested email
+var ErrUserNotFound = errors.New("User not found")
+
+// ErrNotVerified is returned for an unverified user by a server that only
+// serves verified ones
+var ErrNotVerified = errors.New("User email is not verified")
+
+// User ...
+type User struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Phone string `json:"phone,omitempty"`
+
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	Verified bool `json:"verified"`
+	Version  int  `json:"version"`
+}
+
+// RegisterParams ...
+type RegisterParams struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Phone string `json:"phone,omitempty"`
+
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// StatusError is returned for any other non-2xx response
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client ...
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	emailExistStatus int
+}
+
+// Option ...
+type Option func(*Client)
+
+// WithEmailExistStatus matches a server that answers a taken email with code,
+// e.g. 409, instead of the default 403
+func WithEmailExistStatus(code int) Option {
+	return func(c *Client) {
+		c.emailExistStatus = code
+	}
+}
+
+// New returns a Client for the server at baseURL, using http.DefaultClient when hc is nil
+func New(baseURL string, hc *http.Client, opts ...Option) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	c := &Client{
+		baseURL:          strings.TrimRight(baseURL, "/"),
+		httpClient:       hc,
+		emailExistStatus: http.StatusForbidden,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Register may return an ErrEmailExist error
+func (c *Client) Register(ctx context.Context, params *RegisterParams) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/register", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp, map[int]error{c.emailExistStatus: ErrEmailExist})
+}
+
+// GetByEmail may return an ErrUserNotFound or ErrNotVerified error
+func (c *Client) GetByEmail(ctx context.Context, email string) (*User, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/user?email="+url.QueryEscape(email), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp, map[int]error{
+		http.StatusNotFound:  ErrUserNotFound,
+		http.StatusForbidden: ErrNotVerified,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u := &User{}
+	if err := json.NewDecoder(resp.Body).Decode(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// checkResponse returns nil for a 2xx response, the error known maps the
+// status to, or a *StatusError
+func checkResponse(resp *http.Response, known map[int]error) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	if err, ok := known[resp.StatusCode]; ok {
+		return err
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(msg)),
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexlevn/go_simplest_restapi/01.separation/client"
+)
+
+func TestClientAgainstServer(t *testing.T) {
+	joh, _ := newTestServer(t)
+	srv := httptest.NewServer(joh)
+	defer srv.Close()
+
+	c := client.New(srv.URL+"/", srv.Client())
+	ctx := context.Background()
+
+	err := c.Register(ctx, &client.RegisterParams{Email: "alex@example.com", Name: "Alex Lee", Phone: "+84901234567"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := c.GetByEmail(ctx, "alex@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "alex@example.com" || u.Name != "Alex Lee" || u.FirstName != "Alex" || u.Phone != "+84901234567" {
+		t.Errorf("got %+v", u)
+	}
+	if u.ID == "" || u.CreatedAt.IsZero() || u.Version != 1 {
+		t.Errorf("id, created_at or version not decoded: %+v", u)
+	}
+
+	err = c.Register(ctx, &client.RegisterParams{Email: "alex@example.com", Name: "Alex"})
+	if !errors.Is(err, client.ErrEmailExist) {
+		t.Errorf("registering twice: got %v, want ErrEmailExist", err)
+	}
+
+	_, err = c.GetByEmail(ctx, "nobody@example.com")
+	if !errors.Is(err, client.ErrUserNotFound) {
+		t.Errorf("unknown user: got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestClientNotVerified(t *testing.T) {
+	joh, _ := newTestServer(t, WithStrictVerification())
+	srv := httptest.NewServer(joh)
+	defer srv.Close()
+
+	c := client.New(srv.URL, srv.Client())
+	ctx := context.Background()
+	if err := c.Register(ctx, &client.RegisterParams{Email: "alex@example.com", Name: "Alex"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.GetByEmail(ctx, "alex@example.com")
+	if !errors.Is(err, client.ErrNotVerified) {
+		t.Errorf("unverified user: got %v, want ErrNotVerified", err)
+	}
+}
+
+func TestClientEmailExistStatus(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusConflict} {
+		joh, _ := newTestServer(t, WithEmailExistStatus(status))
+		srv := httptest.NewServer(joh)
+		defer srv.Close()
+
+		c := client.New(srv.URL, srv.Client(), client.WithEmailExistStatus(status))
+		ctx := context.Background()
+		params := &client.RegisterParams{Email: "alex@example.com", Name: "Alex"}
+		if err := c.Register(ctx, params); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Register(ctx, params); !errors.Is(err, client.ErrEmailExist) {
+			t.Errorf("%d: registering twice: got %v, want ErrEmailExist", status, err)
+		}
+	}
+
+	// a client expecting 403 sees the 409 of a differently configured server as is
+	joh, _ := newTestServer(t, WithEmailExistStatus(http.StatusConflict))
+	srv := httptest.NewServer(joh)
+	defer srv.Close()
+
+	c := client.New(srv.URL, srv.Client())
+	params := &client.RegisterParams{Email: "alex@example.com", Name: "Alex"}
+	c.Register(context.Background(), params)
+
+	var se *client.StatusError
+	if err := c.Register(context.Background(), params); !errors.As(err, &se) || se.StatusCode != http.StatusConflict {
+		t.Errorf("got %v, want a 409 *StatusError", err)
+	}
+}
+
+func TestClientStatusError(t *testing.T) {
+	joh, _ := newTestServer(t)
+	srv := httptest.NewServer(joh)
+	defer srv.Close()
+
+	c := client.New(srv.URL, nil)
+	err := c.Register(context.Background(), &client.RegisterParams{Email: "no-at-sign", Name: "X"})
+
+	var se *client.StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want a *StatusError", err)
+	}
+	if se.StatusCode != http.StatusBadRequest || se.Message == "" {
+		t.Errorf("got %+v", se)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies parses a comma separated list of CIDRs, a bare IP is
+// taken as a single address
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// remoteIP is the address the request came from, without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func trusted(ip net.IP, proxies []*net.IPNet) bool {
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is only
+// believed when the request comes straight from a trusted proxy, and then
+// the rightmost address not belonging to a trusted proxy wins.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remote := remoteIP(r)
+
+	ip := net.ParseIP(remote)
+	if ip == nil || !trusted(ip, trustedProxies) {
+		return remote
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		remote = hop.String()
+		if !trusted(hop, trustedProxies) {
+			break
+		}
+	}
+	return remote
+}
+
+// WithTrustedProxies makes the lookup lockout see through these proxies
+func WithTrustedProxies(proxies []*net.IPNet) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.trustedProxies = proxies
+	}
+}
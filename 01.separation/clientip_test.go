@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1, 2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct client", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"spoofed header", "203.0.113.5:1234", "198.51.100.7", "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:1234", "198.51.100.7", "198.51.100.7"},
+		{"chain of proxies", "10.1.2.3:1234", "6.6.6.6, 198.51.100.7, 192.0.2.1", "198.51.100.7"},
+		{"bare IP proxy", "192.0.2.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"IPv6 proxy", "[2001:db8::1]:1234", "198.51.100.7", "198.51.100.7"},
+		{"only proxies", "10.1.2.3:1234", "10.9.9.9", "10.9.9.9"},
+		{"garbage hop", "10.1.2.3:1234", "nonsense", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if got := ClientIP(r, proxies); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("a bad CIDR should fail")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// WithDebugDump registers GET /debug/dump, which serves everything in store
+// including verification tokens. It is meant for local development only and
+// is off unless main is started with -dev.
+func WithDebugDump(store Lister) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.dumpStore = store
+	}
+}
+
+// DebugDump handles GET /debug/dump, writing the users the way -store saves them
+func (j *JsonOverHTTP) DebugDump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		j.writeError(w, r, "DebugDump requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	users, err := j.dumpStore.List(r.Context())
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	records := make([]fileRecord, len(users))
+	for i, u := range users {
+		records[i] = fileRecord{User: u, VerificationToken: u.VerificationToken, CreatedAt: u.CreatedAt.Time}
+	}
+
+	j.writeJSON(w, r, http.StatusOK, records)
+}
+
+// WithDebugDeps registers GET /debug/deps, listing the modules built into
+// the binary. Like /debug/dump it is only registered with -dev.
+func WithDebugDeps() HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.debugDeps = true
+	}
+}
+
+type depsResponse struct {
+	GoVersion string       `json:"go_version"`
+	Main      string       `json:"main"`
+	Deps      []dependency `json:"deps"`
+}
+
+type dependency struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	// Replace is the module path a replace directive swapped in, if any
+	Replace string `json:"replace,omitempty"`
+}
+
+// DebugDeps handles GET /debug/deps, answering 501 when the binary was built
+// without module information
+func (j *JsonOverHTTP) DebugDeps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		j.writeError(w, r, "DebugDeps requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		j.writeError(w, r, "Build info is not available in this binary", http.StatusNotImplemented)
+		return
+	}
+
+	resp := depsResponse{
+		GoVersion: info.GoVersion,
+		Main:      info.Main.Path + "@" + info.Main.Version,
+		Deps:      make([]dependency, 0, len(info.Deps)),
+	}
+	for _, m := range info.Deps {
+		dep := dependency{Path: m.Path, Version: m.Version}
+		if m.Replace != nil {
+			dep.Replace = m.Replace.Path + "@" + m.Replace.Version
+		}
+		resp.Deps = append(resp.Deps, dep)
+	}
+
+	j.writeJSON(w, r, http.StatusOK, resp)
+}
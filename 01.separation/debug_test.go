@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDebugDump(t *testing.T) {
+	joh, _ := newTestServer(t)
+	if w := do(joh, http.MethodGet, "/debug/dump", ""); w.Code != http.StatusNotFound {
+		t.Errorf("without -dev: got %d, want 404", w.Code)
+	}
+
+	storage := NewMemoUserStorage()
+	storage.Save(context.Background(), &User{ID: "1", Email: "a@example.com", VerificationToken: "tok"})
+	joh = NewJSONOverHTTP(NewUserServiceImpl(storage), WithDebugDump(storage))
+
+	w := do(joh, http.MethodGet, "/debug/dump", "")
+	var records []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if len(records) != 1 || records[0]["email"] != "a@example.com" || records[0]["verification_token"] != "tok" {
+		t.Errorf("got %v", records)
+	}
+}
+
+func TestDebugDeps(t *testing.T) {
+	joh, _ := newTestServer(t)
+	if w := do(joh, http.MethodGet, "/debug/deps", ""); w.Code != http.StatusNotFound {
+		t.Errorf("without -dev: got %d, want 404", w.Code)
+	}
+
+	joh, _ = newTestServer(t, WithDebugDeps())
+	w := do(joh, http.MethodGet, "/debug/deps", "")
+	var deps depsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &deps); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if !strings.HasPrefix(deps.GoVersion, "go") || len(deps.Deps) == 0 {
+		t.Errorf("got %+v", deps)
+	}
+
+	found := false
+	for _, d := range deps.Deps {
+		if d.Path == "golang.org/x/time" && d.Version != "" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("golang.org/x/time is missing from %+v", deps.Deps)
+	}
+}
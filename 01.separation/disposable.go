@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrDisposableEmail is returned by Register for an email at a throwaway provider
+var ErrDisposableEmail = errors.New("Disposable email addresses are not allowed")
+
+// ErrNoBlocklist is returned when reloading while no block-list is configured
+var ErrNoBlocklist = errors.New("No disposable domain block-list is configured")
+
+//go:embed disposable_domains.txt
+var embeddedDisposableDomains []byte
+
+// DomainSource opens a list of domains, one per line, # starts a comment
+type DomainSource func() (io.ReadCloser, error)
+
+// EmbeddedDomains is the list shipped with the binary
+func EmbeddedDomains() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(embeddedDisposableDomains)), nil
+}
+
+// DomainFile reads the list from path on every reload
+func DomainFile(path string) DomainSource {
+	return func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+}
+
+// Blocklist holds the disposable domains, it can be reloaded from its source
+// while requests are being served
+type Blocklist struct {
+	source DomainSource
+
+	mu      sync.RWMutex
+	domains map[string]bool
+}
+
+// NewBlocklist loads the domains from source
+func NewBlocklist(source DomainSource) (*Blocklist, error) {
+	bl := &Blocklist{source: source}
+	if _, err := bl.Reload(); err != nil {
+		return nil, err
+	}
+	return bl, nil
+}
+
+// Reload rereads the source and returns how many domains it holds. The old
+// list stays in place when reading fails.
+func (bl *Blocklist) Reload() (int, error) {
+	rc, err := bl.source()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	domains := map[string]bool{}
+	sc := bufio.NewScanner(rc)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.ToLower(strings.TrimSpace(line)); line != "" {
+			domains[line] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+
+	bl.mu.Lock()
+	bl.domains = domains
+	bl.mu.Unlock()
+
+	return len(domains), nil
+}
+
+// Blocked reports whether the domain of email, or any of its parents, is listed
+func (bl *Blocklist) Blocked(email string) bool {
+	domain := strings.TrimSuffix(strings.ToLower(email[strings.LastIndexByte(email, '@')+1:]), ".")
+
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+
+	for {
+		if bl.domains[domain] {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			return false
+		}
+		domain = parent
+	}
+}
+
+// WithBlocklist makes Register reject emails at the domains in bl
+func WithBlocklist(bl *Blocklist) ServiceOption {
+	return func(us *UserServiceImpl) {
+		us.blocklist = bl
+	}
+}
+
+// checkDisposable may return an ErrDisposableEmail error
+func (us *UserServiceImpl) checkDisposable(email string) error {
+	if us.blocklist != nil && us.blocklist.Blocked(email) {
+		return ErrDisposableEmail
+	}
+	return nil
+}
+
+// ReloadBlocklist may return an ErrNoBlocklist error
+func (us *UserServiceImpl) ReloadBlocklist(ctx context.Context) (n int, err error) {
+	_, end := us.startSpan(ctx, "ReloadBlocklist")
+	defer func() { end(err) }()
+
+	if us.blocklist == nil {
+		return 0, ErrNoBlocklist
+	}
+	return us.blocklist.Reload()
+}
+
+// ReloadBlocklist handles POST /admin/disposable-domains/reload
+func (j *JsonOverHTTP) ReloadBlocklist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		j.writeError(w, r, "ReloadBlocklist requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n, err := j.usrServ.ReloadBlocklist(r.Context())
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, map[string]int{"domains": n})
+}
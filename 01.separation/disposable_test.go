@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlocklistEmbedded(t *testing.T) {
+	bl, err := NewBlocklist(EmbeddedDomains)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joh := NewJSONOverHTTP(NewUserServiceImpl(NewMemoUserStorage(), WithBlocklist(bl)))
+
+	tests := []struct {
+		email  string
+		status int
+	}{
+		{"a@10minutemail.com", http.StatusUnprocessableEntity},
+		{"b@inbox.10MinuteMail.com", http.StatusUnprocessableEntity},
+		{"c@example.com", http.StatusCreated},
+		{"d@not10minutemail.com", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if w := do(joh, http.MethodPost, "/register", `{"email":"`+tt.email+`", "name":"A"}`); w.Code != tt.status {
+			t.Errorf("%s: got %d %s, want %d", tt.email, w.Code, w.Body, tt.status)
+		}
+	}
+}
+
+func TestBlocklistReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	os.WriteFile(path, []byte("# comment\nthrowaway.test\n"), 0o600)
+
+	bl, err := NewBlocklist(DomainFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	joh := NewJSONOverHTTP(NewUserServiceImpl(NewMemoUserStorage(), WithBlocklist(bl)), WithAdminToken("s3cret"))
+
+	if !bl.Blocked("a@throwaway.test") || bl.Blocked("a@later.test") {
+		t.Fatal("initial list not loaded")
+	}
+
+	os.WriteFile(path, []byte("throwaway.test\nlater.test # added\n"), 0o600)
+	w := do(joh, http.MethodPost, "/admin/disposable-domains/reload", "", "Authorization", testAdminToken)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"domains":2}` {
+		t.Fatalf("reload: got %d %s", w.Code, w.Body)
+	}
+	if !bl.Blocked("a@later.test") {
+		t.Error("reloaded domain not blocked")
+	}
+
+	// a failed reload keeps the old list
+	os.Remove(path)
+	if w := do(joh, http.MethodPost, "/admin/disposable-domains/reload", "", "Authorization", testAdminToken); w.Code != http.StatusInternalServerError {
+		t.Errorf("missing file: got %d, want 500", w.Code)
+	}
+	if !bl.Blocked("a@later.test") {
+		t.Error("failed reload dropped the list")
+	}
+
+	none, _ := newTestServer(t, WithAdminToken("s3cret"))
+	if w := do(none, http.MethodPost, "/admin/disposable-domains/reload", "", "Authorization", testAdminToken); w.Code != http.StatusNotImplemented {
+		t.Errorf("no block-list: got %d, want 501", w.Code)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// DualWriteUserStorage reads from and writes to primary, then mirrors each
+// successful write to secondary in the background. The mirror is applied in
+// write order by a single goroutine. A mirror failure is logged and never
+// fails the primary write, so the secondary may fall behind.
+type DualWriteUserStorage struct {
+	primary   UserStorer
+	secondary UserStorer
+
+	mirror  chan func(context.Context) error
+	pending sync.WaitGroup
+	logger  *log.Logger
+}
+
+// dualWriteLister also forwards List to the primary, for primaries that implement Lister
+type dualWriteLister struct {
+	*DualWriteUserStorage
+	lister Lister
+}
+
+// NewDualWriteUserStorage mirrors writes to secondary through a queue of
+// queueSize writes. When the queue is full the write is dropped from the
+// mirror and logged rather than slowing down the primary.
+func NewDualWriteUserStorage(primary, secondary UserStorer, queueSize int, logger *log.Logger) UserStorer {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	dw := &DualWriteUserStorage{
+		primary:   primary,
+		secondary: secondary,
+		mirror:    make(chan func(context.Context) error, queueSize),
+		logger:    logger,
+	}
+	go dw.run()
+
+	if l, ok := primary.(Lister); ok {
+		return &dualWriteLister{DualWriteUserStorage: dw, lister: l}
+	}
+	return dw
+}
+
+func (dw *DualWriteUserStorage) run() {
+	for op := range dw.mirror {
+		if err := op(context.Background()); err != nil {
+			dw.logger.Printf("dual write: unable to mirror to secondary: %v", err)
+		}
+		dw.pending.Done()
+	}
+}
+
+// enqueue schedules op on the secondary without waiting for it
+func (dw *DualWriteUserStorage) enqueue(what string, op func(context.Context) error) {
+	dw.pending.Add(1)
+	select {
+	case dw.mirror <- op:
+	default:
+		dw.pending.Done()
+		dw.logger.Printf("dual write: mirror queue is full, dropping %s", what)
+	}
+}
+
+func (dw *DualWriteUserStorage) Get(ctx context.Context, email string) (*User, error) {
+	return dw.primary.Get(ctx, email)
+}
+
+func (dw *DualWriteUserStorage) Save(ctx context.Context, user *User) error {
+	if err := dw.primary.Save(ctx, user); err != nil {
+		return err
+	}
+
+	dw.enqueue("save "+user.Email, func(ctx context.Context) error {
+		return dw.secondary.Save(ctx, user)
+	})
+	return nil
+}
+
+// Create only checks the primary for a taken email, the secondary is
+// overwritten to match it
+func (dw *DualWriteUserStorage) Create(ctx context.Context, user *User) error {
+	if err := dw.primary.Create(ctx, user); err != nil {
+		return err
+	}
+
+	dw.enqueue("create "+user.Email, func(ctx context.Context) error {
+		return dw.secondary.Save(ctx, user)
+	})
+	return nil
+}
+
+// Rekey mirrors the result rather than the move, so a secondary that missed
+// the old email still ends up with the user. fn is not run twice.
+func (dw *DualWriteUserStorage) Rekey(ctx context.Context, oldEmail, newEmail string, fn func(*User) error) (*User, error) {
+	u, err := dw.primary.Rekey(ctx, oldEmail, newEmail, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	dw.enqueue("rekey "+oldEmail, func(ctx context.Context) error {
+		if err := dw.secondary.Delete(ctx, oldEmail); err != nil && !errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		return dw.secondary.Save(ctx, u)
+	})
+	return u, nil
+}
+
+// Update runs fn against the primary only and mirrors the updated user, fn
+// is not run twice
+func (dw *DualWriteUserStorage) Update(ctx context.Context, email string, fn func(*User) error) (*User, error) {
+	u, err := dw.primary.Update(ctx, email, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	dw.enqueue("update "+email, func(ctx context.Context) error {
+		return dw.secondary.Save(ctx, u)
+	})
+	return u, nil
+}
+
+// Merge mirrors the merged user and the deletion, fn is not run twice
+func (dw *DualWriteUserStorage) Merge(ctx context.Context, primary, secondary string, fn func(u, from *User) error) (*User, error) {
+	u, err := dw.primary.Merge(ctx, primary, secondary, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	dw.enqueue("merge "+secondary, func(ctx context.Context) error {
+		if err := dw.secondary.Save(ctx, u); err != nil {
+			return err
+		}
+		err := dw.secondary.Delete(ctx, secondary)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	})
+	return u, nil
+}
+
+func (dw *DualWriteUserStorage) Delete(ctx context.Context, email string) error {
+	if err := dw.primary.Delete(ctx, email); err != nil {
+		return err
+	}
+
+	dw.enqueue("delete "+email, func(ctx context.Context) error {
+		err := dw.secondary.Delete(ctx, email)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	})
+	return nil
+}
+
+func (dwl *dualWriteLister) List(ctx context.Context) ([]*User, error) {
+	return dwl.lister.List(ctx)
+}
+
+// Flush waits for the queued mirror writes, then flushes both stores
+func (dw *DualWriteUserStorage) Flush() error {
+	dw.pending.Wait()
+
+	var errs []error
+	for _, us := range []UserStorer{dw.primary, dw.secondary} {
+		if f, ok := us.(Flusher); ok {
+			errs = append(errs, f.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+// failingStorage fails every write
+type failingStorage struct {
+	UserStorer
+}
+
+func (failingStorage) Save(ctx context.Context, user *User) error {
+	return errors.New("replica is down")
+}
+
+func TestDualWriteMirrors(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := NewMemoUserStorage(), NewMemoUserStorage()
+	dw := NewDualWriteUserStorage(primary, secondary, 16, nil)
+
+	dw.Create(ctx, &User{Email: "a@example.com", Name: "A"})
+	dw.Save(ctx, &User{Email: "b@example.com", Name: "B"})
+	dw.Update(ctx, "a@example.com", func(u *User) error {
+		u.Name = "A2"
+		return nil
+	})
+	dw.Rekey(ctx, "b@example.com", "c@example.com", func(*User) error { return nil })
+	dw.Save(ctx, &User{Email: "d@example.com"})
+	dw.Delete(ctx, "d@example.com")
+
+	if err := dw.(Flusher).Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, store := range []*MemoryUserStorage{primary, secondary} {
+		users, _ := store.List(ctx)
+		var got []string
+		for _, u := range users {
+			got = append(got, u.Email+"="+u.Name)
+		}
+		if strings.Join(got, " ") != "a@example.com=A2 c@example.com=B" {
+			t.Errorf("got %v", got)
+		}
+	}
+
+	// reads only go to the primary
+	primary.Save(ctx, &User{Email: "only@example.com"})
+	if _, err := dw.Get(ctx, "only@example.com"); err != nil {
+		t.Error(err)
+	}
+	if _, ok := dw.(Lister); !ok {
+		t.Error("a Lister primary should make a Lister")
+	}
+}
+
+func TestDualWriteSecondaryFailure(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := context.Background()
+	primary := NewMemoUserStorage()
+	dw := NewDualWriteUserStorage(primary, failingStorage{NewMemoUserStorage()}, 16, log.New(&buf, "", 0))
+
+	if err := dw.Save(ctx, &User{Email: "a@example.com"}); err != nil {
+		t.Fatalf("a mirror failure failed the write: %v", err)
+	}
+	dw.(Flusher).Flush()
+
+	if _, err := primary.Get(ctx, "a@example.com"); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(buf.String(), "unable to mirror to secondary: replica is down") {
+		t.Errorf("log: %q", buf.String())
+	}
+}
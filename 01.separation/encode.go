@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// wantsCamelCase reports whether the client asked for camelCase keys with
+// ?case=camel or an X-Key-Case: camel header. snake_case is the default.
+func wantsCamelCase(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("X-Key-Case"), "camel") {
+		return true
+	}
+	return strings.EqualFold(r.URL.Query().Get("case"), "camel")
+}
+
+// Response is the envelope used for every body when the server runs WithEnvelope
+type Response[T any] struct {
+	Data  T              `json:"data"`
+	Error *ResponseError `json:"error"`
+}
+
+// ResponseError ...
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// WithEnvelope wraps successful bodies as {"data": ..., "error": null} and
+// errors as {"data": null, "error": {...}}. Raw bodies stay the default for
+// backward compatibility.
+func WithEnvelope() HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.envelope = true
+	}
+}
+
+// writeJSON encodes v with the key naming convention the client asked for
+// and the server's timestamp format. Storage types keep their snake_case
+// tags, keys are only rewritten on the way out.
+func (j *JsonOverHTTP) writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	if j.envelope {
+		v = Response[any]{Data: v}
+	}
+	writeJSONAs(w, r, status, v, j.timestampFormat)
+}
+
+// writeError is http.Error, or an error envelope WithEnvelope. HEAD requests
+// only get the status.
+func (j *JsonOverHTTP) writeError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(code)
+		return
+	}
+
+	if !j.envelope {
+		http.Error(w, msg, code)
+		return
+	}
+
+	writeJSON(w, r, code, Response[any]{Error: &ResponseError{Code: code, Message: msg}})
+}
+
+// writeJSON is for bodies without a Timestamp, which need writeJSONAs
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	writeJSONAs(w, r, status, v, TimestampRFC3339)
+}
+
+// writeJSONAs encodes v with the key naming convention the client asked for,
+// writing every Timestamp in it in tf
+func writeJSONAs(w http.ResponseWriter, r *http.Request, status int, v interface{}, tf TimestampFormat) {
+	shape := bodyShape{timestamps: tf}
+	if wantsCamelCase(r) {
+		shape.key = snakeToCamel
+	}
+
+	body, err := json.Marshal(v)
+	if err == nil && shape.reshapes() {
+		body, err = reshapeBody(v, body, shape)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// bodyShape is what reshapeBody changes in a response body
+type bodyShape struct {
+	// key renames the keys that come from struct fields, nil keeps them
+	key func(string) string
+	// timestamps is the format every Timestamp is written in
+	timestamps TimestampFormat
+}
+
+// reshapes reports whether the shape changes anything
+func (s bodyShape) reshapes() bool {
+	return s.key != nil || s.timestamps != TimestampRFC3339
+}
+
+// reshapeBody round-trips body, the encoding of v, through maps and applies
+// shape. Map keys are data, like metadata keys or the emails keying a
+// batch-get, and are kept as they are. encoding/json writes map keys in
+// sorted order, so the result is byte-stable across runs even though Go map
+// iteration is not; keep any future map-based projection on this path.
+func reshapeBody(v interface{}, body []byte, shape bodyShape) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(reshape(reflect.ValueOf(v), decoded, shape))
+}
+
+var (
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	timestampType = reflect.TypeOf(Timestamp{})
+)
+
+// reshape walks decoded alongside v, the value it was encoded from, renames
+// the keys of every object encoded from a struct and rewrites every Timestamp
+func reshape(v reflect.Value, decoded interface{}, shape bodyShape) interface{} {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return decoded
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timestampType {
+		if shape.timestamps == TimestampUnix {
+			return json.Number(strconv.FormatInt(v.Interface().(Timestamp).Unix(), 10))
+		}
+		return decoded
+	}
+	if v.Type().Implements(marshalerType) {
+		// the type picks its own keys
+		return decoded
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		obj, ok := decoded.(map[string]interface{})
+		if !ok {
+			return decoded
+		}
+		fields := map[string]reflect.Value{}
+		jsonFields(v, fields)
+
+		out := make(map[string]interface{}, len(obj))
+		for k, val := range obj {
+			if f, ok := fields[k]; ok {
+				val = reshape(f, val, shape)
+			}
+			if shape.key != nil {
+				k = shape.key(k)
+			}
+			out[k] = val
+		}
+		return out
+	case reflect.Map:
+		obj, ok := decoded.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return decoded
+		}
+		for k, val := range obj {
+			elem := v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))
+			if elem.IsValid() {
+				obj[k] = reshape(elem, val, shape)
+			}
+		}
+		return obj
+	case reflect.Slice, reflect.Array:
+		arr, ok := decoded.([]interface{})
+		if !ok || len(arr) != v.Len() {
+			return decoded
+		}
+		for i, val := range arr {
+			arr[i] = reshape(v.Index(i), val, shape)
+		}
+		return arr
+	default:
+		return decoded
+	}
+}
+
+// jsonFields maps the JSON keys of struct v to its fields, following the
+// rules of encoding/json for tags and embedded structs
+func jsonFields(v reflect.Value, fields map[string]reflect.Value) {
+	var embedded []reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" || (!sf.IsExported() && !sf.Anonymous) {
+			continue
+		}
+
+		f := v.Field(i)
+		if sf.Anonymous && name == "" {
+			for f.Kind() == reflect.Pointer && !f.IsNil() {
+				f = f.Elem()
+			}
+			if f.Kind() == reflect.Struct {
+				embedded = append(embedded, f)
+			}
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		fields[name] = f
+	}
+
+	// the fields of v hide the ones it embeds
+	for _, f := range embedded {
+		promoted := map[string]reflect.Value{}
+		jsonFields(f, promoted)
+		for name, pf := range promoted {
+			if _, ok := fields[name]; !ok {
+				fields[name] = pf
+			}
+		}
+	}
+}
+
+// snakeToCamel turns "next_cursor" into "nextCursor". Names that are not
+// snake_case are kept as is.
+func snakeToCamel(s string) string {
+	if !strings.Contains(s, "_") {
+		return s
+	}
+	for _, c := range s {
+		if c != '_' && !unicode.IsLower(c) && !unicode.IsDigit(c) {
+			return s
+		}
+	}
+
+	var b strings.Builder
+	upper := false
+	for _, c := range s {
+		if c == '_' {
+			upper = b.Len() > 0
+			continue
+		}
+		if upper {
+			c = unicode.ToUpper(c)
+			upper = false
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func userKeys(t *testing.T, body []byte) map[string]interface{} {
+	t.Helper()
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatalf("%s: %v", body, err)
+	}
+	return m
+}
+
+func TestUserKeyCase(t *testing.T) {
+	joh, _ := newTestServer(t)
+	do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "first_name":"Alex", "last_name":"Lee"}`)
+
+	snake := userKeys(t, do(joh, http.MethodGet, "/user?email=a@example.com", "").Body.Bytes())
+	for _, k := range []string{"first_name", "last_name", "created_at"} {
+		if _, ok := snake[k]; !ok {
+			t.Errorf("snake_case response is missing %s: %v", k, snake)
+		}
+	}
+
+	for _, req := range [][]string{
+		{"/user?email=a@example.com&case=camel"},
+		{"/user?email=a@example.com", "X-Key-Case", "camel"},
+	} {
+		camel := userKeys(t, do(joh, http.MethodGet, req[0], "", req[1:]...).Body.Bytes())
+		for _, k := range []string{"firstName", "lastName", "createdAt", "email"} {
+			if _, ok := camel[k]; !ok {
+				t.Errorf("%v: camelCase response is missing %s: %v", req, k, camel)
+			}
+		}
+		if _, ok := camel["first_name"]; ok {
+			t.Errorf("%v: camelCase response still has first_name", req)
+		}
+		if camel["firstName"] != snake["first_name"] {
+			t.Errorf("%v: values differ: %v and %v", req, camel["firstName"], snake["first_name"])
+		}
+	}
+}
+
+func TestCamelCaseKeepsMetadataKeys(t *testing.T) {
+	joh, _ := newTestServer(t)
+	w := do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "name":"A", "metadata":{"cost_center":"42"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: got %d %s", w.Code, w.Body)
+	}
+
+	var u struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(do(joh, http.MethodGet, "/user?email=a@example.com&case=camel", "").Body.Bytes(), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Metadata["cost_center"] != "42" || len(u.Metadata) != 1 {
+		t.Errorf("camelCase metadata: got %v, want cost_center kept", u.Metadata)
+	}
+}
+
+func TestSnakeToCamel(t *testing.T) {
+	tests := map[string]string{
+		"next_cursor":       "nextCursor",
+		"id":                "id",
+		"_private":          "private",
+		"a@example.com":     "a@example.com",
+		"Already_Mixed":     "Already_Mixed",
+		"created_at_2":      "createdAt2",
+		"user_a@example.io": "user_a@example.io",
+	}
+	for in, want := range tests {
+		if got := snakeToCamel(in); got != want {
+			t.Errorf("snakeToCamel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	raw, _ := newTestServer(t)
+	wrapped, _ := newTestServer(t, WithEnvelope())
+
+	for _, h := range []http.Handler{raw, wrapped} {
+		mustRegister(t, h, "a@example.com", "A")
+	}
+
+	body := userKeys(t, do(raw, http.MethodGet, "/user?email=a@example.com", "").Body.Bytes())
+	if body["email"] != "a@example.com" {
+		t.Errorf("raw: got %v", body)
+	}
+
+	var ok Response[User]
+	w := do(wrapped, http.MethodGet, "/user?email=a@example.com", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &ok); err != nil {
+		t.Fatal(err)
+	}
+	if ok.Data.Email != "a@example.com" || ok.Error != nil {
+		t.Errorf("wrapped: got %s", w.Body)
+	}
+
+	var failed Response[*User]
+	w = do(wrapped, http.MethodGet, "/user?email=missing@example.com", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &failed); err != nil {
+		t.Fatalf("wrapped error is not JSON: %s", w.Body)
+	}
+	if w.Code != http.StatusNotFound || failed.Data != nil || failed.Error == nil || failed.Error.Code != http.StatusNotFound {
+		t.Errorf("wrapped error: got %d %s", w.Code, w.Body)
+	}
+
+	if w := do(raw, http.MethodGet, "/user?email=missing@example.com", ""); w.Header().Get("Content-Type") == "application/json" {
+		t.Error("raw errors stay plain text")
+	}
+}
+
+func TestCamelizeKeysGolden(t *testing.T) {
+	u := &User{
+		ID:        "1",
+		Email:     "a@example.com",
+		Name:      "Alex Lee",
+		FirstName: "Alex",
+		LastName:  "Lee",
+		Metadata:  map[string]string{"team_name": "core", "z_last": "1", "a_first": "2", "plan": "pro"},
+		CreatedAt: Timestamp{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		Version:   3,
+	}
+	resp := batchGetResponse{
+		Users:   map[string]*User{"a@example.com": u, "b_c@example.com": u},
+		Missing: []string{"x@example.com"},
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := os.ReadFile("testdata/camel_batch.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		got, err := reshapeBody(resp, body, bodyShape{key: snakeToCamel})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(append(got, '\n'), want) {
+			t.Fatalf("run %d differs from testdata/camel_batch.golden:\n%s", i, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+// errorStatuses maps the service's sentinel errors to the status handlers
+// answer with. A new error type only needs a line here. ErrEmailExist is
+// not listed: its status is configurable, see JsonOverHTTP.errorStatus.
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{ErrUserNotFound, http.StatusNotFound},
+	{ErrInvalidToken, http.StatusBadRequest},
+	{ErrNotVerified, http.StatusForbidden},
+	{ErrVersionMismatch, http.StatusPreconditionFailed},
+	{ErrListUnsupported, http.StatusNotImplemented},
+	{ErrStatsUnsupported, http.StatusNotImplemented},
+	{ErrMergeSelf, http.StatusBadRequest},
+	{ErrNoMX, http.StatusBadRequest},
+	{ErrEmailTooLong, http.StatusBadRequest},
+	{ErrEmailLocalTooLong, http.StatusBadRequest},
+	{ErrDomainNotAllowed, http.StatusUnprocessableEntity},
+	{ErrDisposableEmail, http.StatusUnprocessableEntity},
+	{ErrNoBlocklist, http.StatusNotImplemented},
+	{ErrUnknownSort, http.StatusBadRequest},
+}
+
+// errorStatus returns the status for err, 500 for errors it does not know.
+// Request body errors carry their own status.
+func errorStatus(err error) int {
+	var de *jsonbody.Error
+	if errors.As(err, &de) {
+		return de.Status
+	}
+
+	for _, es := range errorStatuses {
+		if errors.Is(err, es.err) {
+			return es.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// errorStatus is errorStatus with the configured status for ErrEmailExist
+func (j *JsonOverHTTP) errorStatus(err error) int {
+	if errors.Is(err, ErrEmailExist) {
+		return j.emailExistStatus
+	}
+	return errorStatus(err)
+}
+
+// writeJSONError answers with err and the status errorStatus maps it to
+func (j *JsonOverHTTP) writeJSONError(w http.ResponseWriter, r *http.Request, err error) {
+	j.writeError(w, r, err.Error(), j.errorStatus(err))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+func TestEmailExistStatus(t *testing.T) {
+	const body = `{"email":"a@example.com", "name":"A"}`
+
+	for _, tt := range []struct {
+		opts   []HTTPOption
+		status int
+	}{
+		{nil, http.StatusForbidden},
+		{[]HTTPOption{WithEmailExistStatus(http.StatusConflict)}, http.StatusConflict},
+	} {
+		joh, _ := newTestServer(t, tt.opts...)
+		mustRegister(t, joh, "a@example.com", "A")
+		mustRegister(t, joh, "b@example.com", "B")
+
+		if w := do(joh, http.MethodPost, "/register", body); w.Code != tt.status {
+			t.Errorf("register: got %d, want %d", w.Code, tt.status)
+		}
+		// every route reports a taken email the same way
+		if w := do(joh, http.MethodPost, "/user/b@example.com/email", `{"new_email":"a@example.com"}`); w.Code != tt.status {
+			t.Errorf("change email: got %d, want %d", w.Code, tt.status)
+		}
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	for _, es := range errorStatuses {
+		if got := errorStatus(es.err); got != es.status {
+			t.Errorf("%v: got %d, want %d", es.err, got, es.status)
+		}
+	}
+
+	if got := errorStatus(errors.New("disk on fire")); got != http.StatusInternalServerError {
+		t.Errorf("unknown error: got %d, want 500", got)
+	}
+	if got := errorStatus(&jsonbody.Error{Status: http.StatusRequestEntityTooLarge, Err: jsonbody.ErrTooLarge}); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("body error: got %d, want 413", got)
+	}
+
+	joh, _ := newTestServer(t, WithEmailExistStatus(http.StatusConflict))
+	if got := joh.errorStatus(ErrEmailExist); got != http.StatusConflict {
+		t.Errorf("ErrEmailExist: got %d, want 409", got)
+	}
+	if got := joh.errorStatus(ErrUserNotFound); got != http.StatusNotFound {
+		t.Errorf("ErrUserNotFound through the server: got %d, want 404", got)
+	}
+}
+
+// wrappingStorage adds another layer of context to every Get error
+type wrappingStorage struct {
+	UserStorer
+}
+
+func (ws wrappingStorage) Get(ctx context.Context, email string) (*User, error) {
+	u, err := ws.UserStorer.Get(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("replica 2: %w", err)
+	}
+	return u, nil
+}
+
+func TestWrappedErrors(t *testing.T) {
+	_, err := NewMemoUserStorage().Get(context.Background(), "none@example.com")
+	if err == ErrUserNotFound || !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("memory storage: got %v, want ErrUserNotFound wrapped", err)
+	}
+
+	joh := NewJSONOverHTTP(NewUserServiceImpl(wrappingStorage{NewMemoUserStorage()}))
+	if w := do(joh, http.MethodGet, "/user?email=none@example.com", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /user: got %d, want 404", w.Code)
+	}
+	// get-or-create only creates on a not found error
+	if w := do(joh, http.MethodPost, "/users/get-or-create", `{"email":"a@example.com", "name":"A"}`); w.Code != http.StatusCreated {
+		t.Errorf("get-or-create: got %d, want 201", w.Code)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Flusher is implemented by storers that buffer writes, main calls Flush
+// during graceful shutdown so nothing is lost
+type Flusher interface {
+	Flush() error
+}
+
+// Flush is a no-op, memory storage has nowhere to write to
+func (ms *MemoryUserStorage) Flush() error {
+	return nil
+}
+
+// FileUserStorage serves from memory and writes the users to a JSON file
+// after every change, so a crash loses nothing that was acknowledged
+type FileUserStorage struct {
+	*MemoryUserStorage
+	path string
+	gzip bool
+
+	flushMu sync.Mutex
+	dirty   bool
+}
+
+// fileRecord keeps the fields the API hides from clients. CreatedAt shadows
+// the user's so the file format does not depend on Timestamp.
+type fileRecord struct {
+	*User
+	VerificationToken string    `json:"verification_token,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// FileOption ...
+type FileOption func(*FileUserStorage)
+
+// WithGzip compresses the file on disk. It is implied by a ".gz" extension.
+func WithGzip() FileOption {
+	return func(fs *FileUserStorage) {
+		fs.gzip = true
+	}
+}
+
+// NewFileUserStorage loads the users saved at path, a missing file starts empty
+func NewFileUserStorage(path string, opts ...FileOption) (*FileUserStorage, error) {
+	fs := &FileUserStorage{
+		MemoryUserStorage: NewMemoUserStorage(),
+		path:              path,
+		gzip:              strings.HasSuffix(path, ".gz"),
+	}
+
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if fs.gzip {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("file storage %s: %w", path, err)
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("file storage %s: %w", path, err)
+		}
+	}
+
+	var records []fileRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("file storage %s: %w", path, err)
+	}
+
+	for _, rec := range records {
+		rec.User.VerificationToken = rec.VerificationToken
+		rec.User.CreatedAt = Timestamp{rec.CreatedAt}
+		fs.store.Save(rec.User)
+	}
+
+	return fs, nil
+}
+
+// persist writes a change through to the file. When writing fails the
+// change stays in memory and the next write or Flush retries it.
+func (fs *FileUserStorage) persist() error {
+	fs.flushMu.Lock()
+	fs.dirty = true
+	fs.flushMu.Unlock()
+
+	return fs.Flush()
+}
+
+func (fs *FileUserStorage) Save(ctx context.Context, user *User) error {
+	if err := fs.MemoryUserStorage.Save(ctx, user); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+func (fs *FileUserStorage) Create(ctx context.Context, user *User) error {
+	if err := fs.MemoryUserStorage.Create(ctx, user); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+func (fs *FileUserStorage) Rekey(ctx context.Context, oldEmail, newEmail string, fn func(*User) error) (*User, error) {
+	u, err := fs.MemoryUserStorage.Rekey(ctx, oldEmail, newEmail, fn)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.persist(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (fs *FileUserStorage) Update(ctx context.Context, email string, fn func(*User) error) (*User, error) {
+	u, err := fs.MemoryUserStorage.Update(ctx, email, fn)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.persist(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (fs *FileUserStorage) Merge(ctx context.Context, primary, secondary string, fn func(u, from *User) error) (*User, error) {
+	u, err := fs.MemoryUserStorage.Merge(ctx, primary, secondary, fn)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.persist(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (fs *FileUserStorage) Delete(ctx context.Context, email string) error {
+	if err := fs.MemoryUserStorage.Delete(ctx, email); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+// Flush writes the users to a temp file and renames it over the old one, so
+// a crash mid-write never leaves a truncated file behind
+func (fs *FileUserStorage) Flush() error {
+	fs.flushMu.Lock()
+	defer fs.flushMu.Unlock()
+
+	if !fs.dirty {
+		return nil
+	}
+
+	users, err := fs.List(context.Background())
+	if err != nil {
+		return err
+	}
+
+	records := make([]fileRecord, len(users))
+	for i, u := range users {
+		records[i] = fileRecord{User: u, VerificationToken: u.VerificationToken, CreatedAt: u.CreatedAt.Time}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if fs.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), fs.path); err != nil {
+		return err
+	}
+
+	fs.dirty = false
+	return nil
+}
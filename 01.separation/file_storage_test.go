@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileUserStorageWriteThrough(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	ctx := context.Background()
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	fs, err := NewFileUserStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Save(ctx, &User{ID: "1", Email: "a@example.com", Name: "A", CreatedAt: Timestamp{created}, VerificationToken: "tok"})
+	fs.Save(ctx, &User{ID: "2", Email: "b@example.com", Name: "B"})
+	fs.Delete(ctx, "b@example.com")
+
+	// every change is on disk without a Flush, as if the process was killed here
+	reloaded, err := NewFileUserStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := reloaded.Get(ctx, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != "1" || u.Name != "A" || u.VerificationToken != "tok" || !u.CreatedAt.Equal(created) {
+		t.Errorf("reloaded %+v", u)
+	}
+	if n := reloaded.store.Count(); n != 1 {
+		t.Errorf("reloaded %d users, want 1", n)
+	}
+}
+
+func TestFileUserStorageMissingFile(t *testing.T) {
+	fs, err := NewFileUserStorage(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fs.store.Count(); n != 0 {
+		t.Errorf("got %d users, want none", n)
+	}
+	// nothing changed, so nothing is written
+	if err := fs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fs.path); !os.IsNotExist(err) {
+		t.Errorf("clean Flush wrote a file: %v", err)
+	}
+}
+
+func TestFileUserStorageGzip(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name string
+		opts []FileOption
+	}{
+		{"users.json.gz", nil},
+		{"users.json", []FileOption{WithGzip()}},
+	} {
+		path := filepath.Join(t.TempDir(), tt.name)
+
+		fs, err := NewFileUserStorage(path, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Save(ctx, &User{ID: "1", Email: "a@example.com", Name: "A"}); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gzip.NewReader(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: file is not gzipped: %v", tt.name, err)
+		}
+
+		reloaded, err := NewFileUserStorage(path, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u, err := reloaded.Get(ctx, "a@example.com"); err != nil || u.Name != "A" {
+			t.Errorf("%s: reloaded %+v, %v", tt.name, u, err)
+		}
+
+		// only the file itself is left, the temp file was renamed over it
+		entries, _ := os.ReadDir(filepath.Dir(path))
+		if len(entries) != 1 {
+			t.Errorf("%s: %d files in the directory, want 1", tt.name, len(entries))
+		}
+	}
+}
+
+func TestFileUserStorageWriteError(t *testing.T) {
+	fs, err := NewFileUserStorage(filepath.Join(t.TempDir(), "gone", "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Save(context.Background(), &User{ID: "1", Email: "a@example.com"}); err == nil {
+		t.Error("a save that never reached the file succeeded")
+	}
+}
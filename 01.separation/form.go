@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+// isForm reports whether the request body is application/x-www-form-urlencoded
+func isForm(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "application/x-www-form-urlencoded"
+}
+
+// decodeRegisterForm fills params from a form body of at most maxBytes, using
+// the JSON field names. Metadata is given as metadata[key]=value.
+func decodeRegisterForm(w http.ResponseWriter, r *http.Request, params *RegisterParams, maxBytes int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	if err := r.ParseForm(); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return &jsonbody.Error{Status: http.StatusRequestEntityTooLarge, Err: jsonbody.ErrTooLarge}
+		}
+		return &jsonbody.Error{Status: http.StatusBadRequest, Err: jsonbody.ErrMalformed}
+	}
+
+	form := r.PostForm
+	params.Email = form.Get("email")
+	params.Name = form.Get("name")
+	params.Phone = form.Get("phone")
+	params.FirstName = form.Get("first_name")
+	params.LastName = form.Get("last_name")
+
+	for key, values := range form {
+		k, ok := strings.CutPrefix(key, "metadata[")
+		if !ok || !strings.HasSuffix(k, "]") {
+			continue
+		}
+		if params.Metadata == nil {
+			params.Metadata = map[string]string{}
+		}
+		params.Metadata[strings.TrimSuffix(k, "]")] = values[0]
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+// GetOrCreate returns the user registered under params.Email, registering it
+// first when missing. created reports which of the two happened.
+func (us *UserServiceImpl) GetOrCreate(ctx context.Context, params *RegisterParams) (u *User, created bool, err error) {
+	ctx, end := us.startSpan(ctx, "GetOrCreate")
+	defer func() { end(err) }()
+
+	u, err = us.userStorage.Get(ctx, params.Email)
+	if err == nil {
+		return u, false, nil
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return nil, false, err
+	}
+
+	err = us.Register(ctx, params)
+	if err == nil {
+		created = true
+	} else if !errors.Is(err, ErrEmailExist) {
+		// ErrEmailExist means another request created it in the meantime
+		return nil, false, err
+	}
+
+	u, err = us.userStorage.Get(ctx, params.Email)
+	if err != nil {
+		return nil, false, err
+	}
+	return u, created, nil
+}
+
+// GetOrCreateUser handles POST /users/get-or-create, 200 for an existing user and 201 for a new one.
+// Creating is refused like POST /register when that route is disabled or throttled.
+func (j *JsonOverHTTP) GetOrCreateUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		j.writeError(w, r, "GetOrCreateUser requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if j.lockedOut(w, r) {
+		return
+	}
+
+	params := &RegisterParams{}
+	err := jsonbody.Decode(w, r, params, j.bodyLimits)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	if j.lenient {
+		params.defaultName()
+	}
+
+	err = j.validationRules.validate(params)
+	if err != nil {
+		j.writeError(w, r, err.Error(), validationStatus(err))
+		return
+	}
+
+	u, err := j.usrServ.GetByEmail(r.Context(), params.Email)
+	if err == nil {
+		j.writeJSON(w, r, http.StatusOK, u)
+		return
+	} else if !errors.Is(err, ErrUserNotFound) {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	// a new email is a registration and goes through the same gates as /register
+	if j.disabled["/register"] {
+		j.failLookup(r)
+		j.writeJSONError(w, r, err)
+		return
+	}
+	if j.registerLimiter != nil && !j.registerLimiter.Allow() {
+		w.Header().Set("Retry-After", "1")
+		j.writeError(w, r, "Too many registrations, please try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	u, created, err := j.usrServ.GetOrCreate(r.Context(), params)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		// a 201 tells the client the email was unknown, count it like a miss
+		j.failLookup(r)
+		status = http.StatusCreated
+	}
+	j.writeJSON(w, r, status, u)
+}
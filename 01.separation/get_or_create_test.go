@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestGetOrCreateUser(t *testing.T) {
+	joh, _ := newTestServer(t)
+
+	var ids []string
+	for _, status := range []int{http.StatusCreated, http.StatusOK} {
+		w := do(joh, http.MethodPost, "/users/get-or-create", `{"email":"a@example.com", "name":"A"}`)
+		var u User
+		if err := json.Unmarshal(w.Body.Bytes(), &u); err != nil || w.Code != status {
+			t.Fatalf("got %d %s, want %d", w.Code, w.Body, status)
+		}
+		ids = append(ids, u.ID)
+	}
+	if ids[0] == "" || ids[0] != ids[1] {
+		t.Errorf("ids %v, want the same user twice", ids)
+	}
+
+	if w := do(joh, http.MethodPost, "/users/get-or-create", `{"email":"bad", "name":"A"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid email: got %d, want 400", w.Code)
+	}
+}
+
+func TestGetOrCreateRegisterGates(t *testing.T) {
+	limited, _ := newTestServer(t, WithRegisterLimit(0, 1))
+	mustRegister(t, limited, "a@example.com", "A")
+
+	for _, email := range []string{"b@example.com", "c@example.com"} {
+		w := do(limited, http.MethodPost, "/users/get-or-create", `{"email":"`+email+`", "name":"B"}`)
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s while /register is throttled: got %d %s, want 429", email, w.Code, w.Body)
+		}
+	}
+	if w := do(limited, http.MethodPost, "/users/get-or-create", `{"email":"a@example.com", "name":"A"}`); w.Code != http.StatusOK {
+		t.Errorf("existing user while /register is throttled: got %d, want 200", w.Code)
+	}
+
+	disabled, storage := newTestServer(t, WithDisabledRoutes("/register"))
+	storage.Save(context.Background(), &User{ID: "1", Email: "a@example.com", Name: "A"})
+
+	if w := do(disabled, http.MethodPost, "/users/get-or-create", `{"email":"b@example.com", "name":"B"}`); w.Code != http.StatusNotFound {
+		t.Errorf("new user while /register is disabled: got %d, want 404", w.Code)
+	}
+	if _, err := storage.Get(context.Background(), "b@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("b@example.com was created: %v", err)
+	}
+	if w := do(disabled, http.MethodPost, "/users/get-or-create", `{"email":"a@example.com", "name":"A"}`); w.Code != http.StatusOK {
+		t.Errorf("existing user while /register is disabled: got %d, want 200", w.Code)
+	}
+}
+
+func TestGetOrCreateConcurrent(t *testing.T) {
+	storage := NewMemoUserStorage()
+	us := NewUserServiceImpl(storage)
+
+	const n = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+		ids     = map[string]bool{}
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, c, err := us.GetOrCreate(context.Background(), &RegisterParams{Email: "a@example.com", Name: "A"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			ids[u.ID] = true
+			if c {
+				created++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 || len(ids) != 1 {
+		t.Errorf("%d created, %d distinct ids, want 1 of each", created, len(ids))
+	}
+}
+
+func TestCreateTakenEmail(t *testing.T) {
+	storage := NewMemoUserStorage()
+
+	const n = 20
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- storage.Create(context.Background(), &User{Email: "a@example.com"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	ok := 0
+	for err := range errs {
+		if err == nil {
+			ok++
+		} else if !errors.Is(err, ErrEmailExist) {
+			t.Errorf("got %v, want ErrEmailExist", err)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("%d creates succeeded, want 1", ok)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthChecker is implemented by every subsystem that reports to GET /readyz
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// HealthRegistry ...
+type HealthRegistry struct {
+	mu       sync.RWMutex
+	checkers []HealthChecker
+}
+
+// Register ...
+func (hr *HealthRegistry) Register(hc HealthChecker) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.checkers = append(hr.checkers, hc)
+}
+
+// Check runs every checker concurrently and returns "ok" or the error per name
+func (hr *HealthRegistry) Check(ctx context.Context) (map[string]string, bool) {
+	hr.mu.RLock()
+	checkers := append([]HealthChecker(nil), hr.checkers...)
+	hr.mu.RUnlock()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]string, len(checkers))
+		healthy = true
+	)
+
+	for _, hc := range checkers {
+		wg.Add(1)
+		go func(hc HealthChecker) {
+			defer wg.Done()
+
+			status := "ok"
+			if err := hc.Check(ctx); err != nil {
+				status = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[hc.Name()] = status
+			if status != "ok" {
+				healthy = false
+			}
+		}(hc)
+	}
+	wg.Wait()
+
+	return results, healthy
+}
+
+// storageHealth reports the storage healthy as long as a lookup succeeds or
+// comes back not found
+type storageHealth struct {
+	us UserStorer
+}
+
+func (sh storageHealth) Name() string {
+	return "storage"
+}
+
+func (sh storageHealth) Check(ctx context.Context) error {
+	_, err := sh.us.Get(ctx, "healthcheck@localhost")
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	return err
+}
+
+// WaitForReady retries hc with backoff until it passes or timeout elapses, so
+// startup can wait for a storage that comes up after the server does
+func WaitForReady(ctx context.Context, hc HealthChecker, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	backoff := 50 * time.Millisecond
+	for {
+		err := hc.Check(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s not ready after %s: %v", hc.Name(), timeout, err)
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, time.Second)
+	}
+}
+
+// WithHealthRegistry exposes hr on GET /readyz
+func WithHealthRegistry(hr *HealthRegistry) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.health = hr
+	}
+}
+
+type readyzResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Readyz answers 200 only when every registered checker passes, 503 otherwise
+func (j *JsonOverHTTP) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	checks, healthy := j.health.Check(ctx)
+	if !healthy {
+		j.writeJSON(w, r, http.StatusServiceUnavailable, readyzResponse{Status: "unavailable", Checks: checks})
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, readyzResponse{Status: "ok", Checks: checks})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeChecker fails with err, nil passes
+type fakeChecker struct {
+	name string
+	err  error
+}
+
+func (fc fakeChecker) Name() string                    { return fc.name }
+func (fc fakeChecker) Check(ctx context.Context) error { return fc.err }
+
+func TestReadyz(t *testing.T) {
+	hr := &HealthRegistry{}
+	hr.Register(fakeChecker{name: "cache"})
+	joh, _ := newTestServer(t, WithHealthRegistry(hr))
+
+	if w := do(joh, http.MethodGet, "/readyz", ""); w.Code != http.StatusOK {
+		t.Fatalf("all passing: got %d %s", w.Code, w.Body)
+	}
+
+	hr.Register(fakeChecker{name: "mailer", err: errors.New("connection refused")})
+	w := do(joh, http.MethodGet, "/readyz", "")
+	var resp readyzResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("one failing: got %d %s", w.Code, w.Body)
+	}
+	if resp.Checks["cache"] != "ok" || resp.Checks["mailer"] != "connection refused" {
+		t.Errorf("got %+v", resp.Checks)
+	}
+}
+
+// delayedChecker fails until ready has passed
+type delayedChecker struct {
+	ready time.Time
+	calls int
+}
+
+func (dc *delayedChecker) Name() string { return "storage" }
+
+func (dc *delayedChecker) Check(ctx context.Context) error {
+	dc.calls++
+	if time.Now().Before(dc.ready) {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestWaitForReady(t *testing.T) {
+	dc := &delayedChecker{ready: time.Now().Add(200 * time.Millisecond)}
+	if err := WaitForReady(context.Background(), dc, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if dc.calls < 2 {
+		t.Errorf("checked %d times, want a retry", dc.calls)
+	}
+
+	never := &delayedChecker{ready: time.Now().Add(time.Hour)}
+	err := WaitForReady(context.Background(), never, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "storage not ready") {
+		t.Errorf("got %v, want a not ready error", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alexlevn/go_simplest_restapi/textfold"
+)
+
+// ListByInitial returns the users whose name starts with letter, ignoring case
+// and accents, sorted by name. It may return an ErrListUnsupported error.
+func (us *UserServiceImpl) ListByInitial(ctx context.Context, letter rune) (users []*User, err error) {
+	ctx, end := us.startSpan(ctx, "ListByInitial")
+	defer func() { end(err) }()
+
+	lister, ok := us.userStorage.(Lister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+
+	all, err := lister.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	letter, _ = utf8.DecodeRuneInString(textfold.Fold(string(letter)))
+	users = []*User{}
+	for _, u := range all {
+		first, _ := utf8.DecodeRuneInString(textfold.Fold(u.Name))
+		if first == letter {
+			users = append(users, u)
+		}
+	}
+
+	// sorted by the same folding the match uses, so "Émile" sorts before "Ezra"
+	sort.SliceStable(users, func(i, j int) bool {
+		return textfold.Fold(users[i].Name) < textfold.Fold(users[j].Name)
+	})
+
+	return users, nil
+}
+
+type letterIndexResponse struct {
+	Items []*User `json:"items"`
+}
+
+// ListUsersByLetter handles GET /users/index/{letter} for an A-Z index
+func (j *JsonOverHTTP) ListUsersByLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		j.writeError(w, r, "ListUsersByLetter requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	param := strings.TrimPrefix(r.URL.Path, "/users/index/")
+	letter, size := utf8.DecodeRuneInString(param)
+	if size == 0 || size != len(param) || !unicode.IsLetter(letter) {
+		j.writeError(w, r, "Index must be a single letter", http.StatusBadRequest)
+		return
+	}
+
+	users, err := j.usrServ.ListByInitial(r.Context(), letter)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, letterIndexResponse{Items: users})
+}
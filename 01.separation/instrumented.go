@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// MetricsSink receives the duration and outcome of every storage call. It is
+// transport-agnostic, so it can feed Prometheus histograms or a test spy.
+type MetricsSink interface {
+	Observe(op string, d time.Duration, err error)
+}
+
+// MetricsFunc adapts a plain function to a MetricsSink
+type MetricsFunc func(op string, d time.Duration, err error)
+
+// Observe ...
+func (f MetricsFunc) Observe(op string, d time.Duration, err error) {
+	f(op, d, err)
+}
+
+// InstrumentedUserStorage times every call to the wrapped UserStorer
+type InstrumentedUserStorage struct {
+	next UserStorer
+	sink MetricsSink
+}
+
+// instrumentedLister also forwards List, for storers that implement Lister
+type instrumentedLister struct {
+	*InstrumentedUserStorage
+	lister Lister
+}
+
+// NewInstrumentedUserStorage wraps us, keeping its Lister capability if it has one
+func NewInstrumentedUserStorage(us UserStorer, sink MetricsSink) UserStorer {
+	ius := &InstrumentedUserStorage{next: us, sink: sink}
+	if l, ok := us.(Lister); ok {
+		return &instrumentedLister{InstrumentedUserStorage: ius, lister: l}
+	}
+	return ius
+}
+
+func (ius *InstrumentedUserStorage) observe(op string, start time.Time, err error) {
+	ius.sink.Observe(op, time.Since(start), err)
+}
+
+func (ius *InstrumentedUserStorage) Get(ctx context.Context, email string) (u *User, err error) {
+	start := time.Now()
+	defer func() { ius.observe("Get", start, err) }()
+	return ius.next.Get(ctx, email)
+}
+
+func (ius *InstrumentedUserStorage) Save(ctx context.Context, user *User) (err error) {
+	start := time.Now()
+	defer func() { ius.observe("Save", start, err) }()
+	return ius.next.Save(ctx, user)
+}
+
+func (ius *InstrumentedUserStorage) Create(ctx context.Context, user *User) (err error) {
+	start := time.Now()
+	defer func() { ius.observe("Create", start, err) }()
+	return ius.next.Create(ctx, user)
+}
+
+func (ius *InstrumentedUserStorage) Rekey(ctx context.Context, oldEmail, newEmail string, fn func(*User) error) (u *User, err error) {
+	start := time.Now()
+	defer func() { ius.observe("Rekey", start, err) }()
+	return ius.next.Rekey(ctx, oldEmail, newEmail, fn)
+}
+
+func (ius *InstrumentedUserStorage) Update(ctx context.Context, email string, fn func(*User) error) (u *User, err error) {
+	start := time.Now()
+	defer func() { ius.observe("Update", start, err) }()
+	return ius.next.Update(ctx, email, fn)
+}
+
+func (ius *InstrumentedUserStorage) Merge(ctx context.Context, primary, secondary string, fn func(u, from *User) error) (u *User, err error) {
+	start := time.Now()
+	defer func() { ius.observe("Merge", start, err) }()
+	return ius.next.Merge(ctx, primary, secondary, fn)
+}
+
+func (ius *InstrumentedUserStorage) Delete(ctx context.Context, email string) (err error) {
+	start := time.Now()
+	defer func() { ius.observe("Delete", start, err) }()
+	return ius.next.Delete(ctx, email)
+}
+
+func (il *instrumentedLister) List(ctx context.Context) (users []*User, err error) {
+	start := time.Now()
+	defer func() { il.observe("List", start, err) }()
+	return il.lister.List(ctx)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type observation struct {
+	op  string
+	d   time.Duration
+	err error
+}
+
+// spySink remembers every observation
+type spySink struct {
+	mu   sync.Mutex
+	seen []observation
+}
+
+func (s *spySink) Observe(op string, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen = append(s.seen, observation{op, d, err})
+}
+
+func TestInstrumentedUserStorage(t *testing.T) {
+	spy := &spySink{}
+	storage := NewInstrumentedUserStorage(NewMemoUserStorage(), spy)
+	ctx := context.Background()
+
+	if err := storage.Save(ctx, &User{Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Get(ctx, "a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Get(ctx, "missing@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("got %v", err)
+	}
+
+	if len(spy.seen) != 3 {
+		t.Fatalf("got %d observations, want 3: %+v", len(spy.seen), spy.seen)
+	}
+	for i, want := range []observation{{op: "Save"}, {op: "Get"}, {op: "Get", err: ErrUserNotFound}} {
+		got := spy.seen[i]
+		if got.op != want.op || !errors.Is(got.err, want.err) || (want.err == nil && got.err != nil) || got.d < 0 {
+			t.Errorf("observation %d = %+v, want %s with %v", i, got, want.op, want.err)
+		}
+	}
+
+	if _, ok := storage.(Lister); !ok {
+		t.Error("wrapping a Lister lost the List method")
+	}
+	if _, ok := NewInstrumentedUserStorage(noListStorage{NewMemoUserStorage()}, spy).(Lister); ok {
+		t.Error("wrapping a storer without List gained one")
+	}
+}
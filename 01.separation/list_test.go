@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeList(t *testing.T, h http.Handler, target string) userListResponse {
+	t.Helper()
+
+	w := do(h, http.MethodGet, target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: got %d %s", target, w.Code, w.Body)
+	}
+	var page userListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestListUsersCursor(t *testing.T) {
+	joh, _ := newTestServer(t)
+
+	var want []string
+	for i := 4; i >= 0; i-- {
+		email := fmt.Sprintf("user%d@example.com", i)
+		mustRegister(t, joh, email, "User")
+		want = append(want, email)
+	}
+	slices.Sort(want)
+
+	var got []string
+	pages := 0
+	target := "/users?limit=2"
+	for {
+		page := decodeList(t, joh, target)
+		pages++
+		if len(page.Items) > 2 {
+			t.Fatalf("page %d has %d items, limit is 2", pages, len(page.Items))
+		}
+		for _, u := range page.Items {
+			got = append(got, u.Email)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		target = "/users?limit=2&cursor=" + url.QueryEscape(page.NextCursor)
+	}
+
+	if pages != 3 {
+		t.Errorf("walked %d pages, want 3", pages)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestListUsersBadParams(t *testing.T) {
+	joh, _ := newTestServer(t)
+
+	for _, target := range []string{"/users?cursor=%25%25", "/users?limit=0", "/users?limit=x"} {
+		if w := do(joh, http.MethodGet, target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: got %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestListUsersCreatedRange(t *testing.T) {
+	joh, storage := newTestServer(t)
+
+	base := time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 4; i++ {
+		storage.Save(context.Background(), &User{
+			Email:     fmt.Sprintf("day%d@example.com", i),
+			CreatedAt: Timestamp{base.AddDate(0, 0, i)},
+		})
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"created_after=2024-01-02T12:00:00Z", []string{"day3@example.com", "day4@example.com"}},
+		{"created_before=2024-01-03T00:00:00Z", []string{"day1@example.com", "day2@example.com"}},
+		{"created_after=2024-01-01T12:00:00Z&created_before=2024-01-04T00:00:00Z", []string{"day2@example.com", "day3@example.com"}},
+	}
+	for _, tt := range tests {
+		page := decodeList(t, joh, "/users?"+tt.query)
+		var got []string
+		for _, u := range page.Items {
+			got = append(got, u.Email)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if w := do(joh, http.MethodGet, "/users?created_after=yesterday", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("bad bound: got %d, want 400", w.Code)
+	}
+}
+
+// noListStorage hides the optional MemoryUserStorage methods, List and Stats
+// among them, behind the UserStorer interface
+type noListStorage struct {
+	UserStorer
+}
+
+func TestListUsersUnsupported(t *testing.T) {
+	joh := NewJSONOverHTTP(NewUserServiceImpl(noListStorage{NewMemoUserStorage()}))
+
+	w := do(joh, http.MethodGet, "/users", "")
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("got %d, want 501", w.Code)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %s", w.Body)
+	}
+	if body["error"] != ErrListUnsupported.Error() {
+		t.Errorf("got %v", body)
+	}
+}
+
+func TestListUsersByLetter(t *testing.T) {
+	joh, _ := newTestServer(t)
+	mustRegister(t, joh, "a@example.com", "bao")
+	mustRegister(t, joh, "b@example.com", "Anh")
+	mustRegister(t, joh, "c@example.com", "Ánh Dương")
+	mustRegister(t, joh, "d@example.com", "Binh")
+
+	var got []string
+	for _, letter := range []string{"a", "A"} {
+		w := do(joh, http.MethodGet, "/users/index/"+letter, "")
+		var index letterIndexResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", letter, w.Code, w.Body)
+		}
+		got = got[:0]
+		for _, u := range index.Items {
+			got = append(got, u.Email)
+		}
+		if !slices.Equal(got, []string{"b@example.com", "c@example.com"}) {
+			t.Errorf("%s: got %v", letter, got)
+		}
+	}
+
+	// accented names sort by the folded name they matched on
+	mustRegister(t, joh, "e@example.com", "Ezra")
+	mustRegister(t, joh, "f@example.com", "Émile")
+	mustRegister(t, joh, "g@example.com", "Eric")
+	var index letterIndexResponse
+	json.Unmarshal(do(joh, http.MethodGet, "/users/index/e", "").Body.Bytes(), &index)
+	got = got[:0]
+	for _, u := range index.Items {
+		got = append(got, u.Name)
+	}
+	if !slices.Equal(got, []string{"Émile", "Eric", "Ezra"}) {
+		t.Errorf("e: got %v", got)
+	}
+
+	w := do(joh, http.MethodGet, "/users/index/z", "")
+	if w.Code != http.StatusOK || w.Body.String() != "{\"items\":[]}\n" {
+		t.Errorf("empty letter: got %d %q", w.Code, w.Body)
+	}
+
+	for _, param := range []string{"1", "ab", "", "%20"} {
+		if w := do(joh, http.MethodGet, "/users/index/"+param, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: got %d, want 400", param, w.Code)
+		}
+	}
+}
+
+func TestListUsersLinkHeader(t *testing.T) {
+	joh, _ := newTestServer(t)
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		mustRegister(t, joh, email, "User")
+	}
+
+	w := do(joh, http.MethodGet, "/users?limit=2", "")
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, `</users?limit=2>; rel="first"`) || !strings.Contains(link, `rel="next"`) {
+		t.Errorf("first page Link: %q", link)
+	}
+
+	var page userListResponse
+	json.Unmarshal(w.Body.Bytes(), &page)
+	w = do(joh, http.MethodGet, "/users?limit=2&cursor="+url.QueryEscape(page.NextCursor), "")
+	if link := w.Header().Get("Link"); strings.Contains(link, `rel="next"`) {
+		t.Errorf("last page Link has a next: %q", link)
+	}
+}
+
+func TestListUsersSort(t *testing.T) {
+	emails := func(page userListResponse) string {
+		var got []string
+		for _, u := range page.Items {
+			got = append(got, u.Email)
+		}
+		return strings.Join(got, " ")
+	}
+
+	joh, storage := newTestServer(t, WithDefaultSort("name"))
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, u := range []struct{ email, name string }{
+		{"a@example.com", "Zoe"},
+		{"b@example.com", "Ánh"},
+		{"c@example.com", "Minh"},
+		{"d@example.com", "Minh"},
+	} {
+		storage.Save(context.Background(), &User{Email: u.email, Name: u.name, CreatedAt: Timestamp{base.Add(-time.Duration(i) * time.Hour)}})
+	}
+
+	tests := map[string]string{
+		"/users":                 "b@example.com c@example.com d@example.com a@example.com",
+		"/users?sort=email":      "a@example.com b@example.com c@example.com d@example.com",
+		"/users?sort=created_at": "d@example.com c@example.com b@example.com a@example.com",
+	}
+	for target, want := range tests {
+		if got := emails(decodeList(t, joh, target)); got != want {
+			t.Errorf("GET %s: got %s, want %s", target, got, want)
+		}
+	}
+
+	// pages of a name sort follow on from each other, ties included
+	first := decodeList(t, joh, "/users?limit=2")
+	second := decodeList(t, joh, "/users?limit=2&cursor="+url.QueryEscape(first.NextCursor))
+	if emails(first)+" "+emails(second) != tests["/users"] {
+		t.Errorf("pages: %s | %s", emails(first), emails(second))
+	}
+
+	if w := do(joh, http.MethodGet, "/users?sort=phone", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown sort: got %d, want 400", w.Code)
+	}
+}
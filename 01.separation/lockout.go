@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Lockout counts failed lookups per client and locks a client out once it
+// reaches threshold failures within window, until the window ends
+type Lockout struct {
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	failures map[string]*lockoutEntry
+}
+
+type lockoutEntry struct {
+	count int
+	start time.Time
+}
+
+// NewLockout ...
+func NewLockout(threshold int, window time.Duration) *Lockout {
+	return &Lockout{
+		threshold: threshold,
+		window:    window,
+		failures:  map[string]*lockoutEntry{},
+	}
+}
+
+// Locked reports whether key is locked out and for how much longer
+func (l *Lockout) Locked(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := l.entry(key, time.Now())
+	if e == nil || e.count < l.threshold {
+		return false, 0
+	}
+	return true, time.Until(e.start.Add(l.window))
+}
+
+// Fail records a failed attempt by key
+func (l *Lockout) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	e := l.entry(key, now)
+	if e == nil {
+		e = &lockoutEntry{start: now}
+		l.failures[key] = e
+	}
+	e.count++
+}
+
+// entry returns the live entry for key, dropping it once its window is over
+func (l *Lockout) entry(key string, now time.Time) *lockoutEntry {
+	e, ok := l.failures[key]
+	if !ok {
+		return nil
+	}
+	if now.Sub(e.start) >= l.window {
+		delete(l.failures, key)
+		return nil
+	}
+	return e
+}
+
+// WithLookupLockout answers 429 to clients with too many lookups of unknown users
+func WithLookupLockout(l *Lockout) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.lockout = l
+	}
+}
+
+// lockedOut answers 429 and returns true when the client is locked out
+func (j *JsonOverHTTP) lockedOut(w http.ResponseWriter, r *http.Request) bool {
+	if j.lockout == nil {
+		return false
+	}
+
+	locked, retry := j.lockout.Locked(ClientIP(r, j.trustedProxies))
+	if !locked {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+	j.writeError(w, r, "Too many failed lookups, please try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// failLookup counts a lookup of an unknown user against the client
+func (j *JsonOverHTTP) failLookup(r *http.Request) {
+	if j.lockout != nil {
+		j.lockout.Fail(ClientIP(r, j.trustedProxies))
+	}
+}
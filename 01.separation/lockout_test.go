@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupLockoutRoutes(t *testing.T) {
+	// each request looks up none@example.com, which nobody registered
+	admin := []string{"Authorization", testAdminToken}
+	routes := []struct {
+		method, target, body string
+		header               []string
+	}{
+		{http.MethodGet, "/user?email=none@example.com", "", nil},
+		{http.MethodGet, "/users/none@example.com", "", nil},
+		{http.MethodGet, "/users?email=none@example.com", "", nil},
+		{http.MethodPost, "/users/batch-get", `{"emails":["none@example.com"]}`, nil},
+		{http.MethodGet, "/register/check?email=none@example.com", "", nil},
+		{http.MethodPost, "/users/get-or-create", `{"email":"none@example.com", "name":"None"}`, nil},
+		{http.MethodPost, "/user/none@example.com/email", `{"new_email":"x@example.com"}`, nil},
+		{http.MethodPut, "/user?email=none@example.com", `{"name":"None"}`, []string{"If-Match", `"1"`}},
+		{http.MethodPost, "/users/merge", `{"primary_email":"a@example.com", "secondary_email":"none@example.com"}`, nil},
+		{http.MethodPost, "/users/bulk-delete", `{"emails":["none@example.com"]}`, admin},
+	}
+
+	for _, rt := range routes {
+		joh, _ := newTestServer(t, WithLookupLockout(NewLockout(2, time.Minute)), WithAdminToken("s3cret"))
+		mustRegister(t, joh, "a@example.com", "A")
+
+		for i := 0; i < 2; i++ {
+			// a fresh email each time, get-or-create only misses once per email
+			email := fmt.Sprintf("none%d@", i)
+			target, body := strings.Replace(rt.target, "none@", email, 1), strings.Replace(rt.body, "none@", email, 1)
+			if w := do(joh, rt.method, target, body, rt.header...); w.Code == http.StatusTooManyRequests {
+				t.Fatalf("%s %s: locked out after %d misses", rt.method, rt.target, i)
+			}
+		}
+
+		// the lockout covers known users and the other routes too
+		w := do(joh, http.MethodGet, "/user?email=a@example.com", "")
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("after 2 misses on %s %s: got %d, want 429", rt.method, rt.target, w.Code)
+		}
+		if w := do(joh, rt.method, rt.target, rt.body, rt.header...); w.Code != http.StatusTooManyRequests {
+			t.Errorf("%s %s while locked out: got %d, want 429", rt.method, rt.target, w.Code)
+		}
+	}
+}
+
+func TestLookupLockoutTakenEmail(t *testing.T) {
+	joh, _ := newTestServer(t, WithLookupLockout(NewLockout(2, time.Minute)))
+	mustRegister(t, joh, "a@example.com", "A")
+	mustRegister(t, joh, "b@example.com", "B")
+
+	// moving onto a taken email tells the client it exists
+	for i := 0; i < 2; i++ {
+		if w := do(joh, http.MethodPost, "/user/a@example.com/email", `{"new_email":"b@example.com"}`); w.Code != http.StatusForbidden {
+			t.Fatalf("attempt %d: got %d, want 403", i, w.Code)
+		}
+	}
+	if w := do(joh, http.MethodPost, "/user/a@example.com/email", `{"new_email":"b@example.com"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("after 2 probes: got %d, want 429", w.Code)
+	}
+}
+
+func TestLookupLockoutRecovers(t *testing.T) {
+	joh, _ := newTestServer(t, WithLookupLockout(NewLockout(2, 100*time.Millisecond)))
+	mustRegister(t, joh, "a@example.com", "A")
+
+	// hits do not count
+	for i := 0; i < 3; i++ {
+		if w := do(joh, http.MethodGet, "/user?email=a@example.com", ""); w.Code != http.StatusOK {
+			t.Fatalf("hit %d: got %d", i, w.Code)
+		}
+	}
+
+	do(joh, http.MethodGet, "/user?email=none@example.com", "")
+	do(joh, http.MethodGet, "/user?email=none@example.com", "")
+	if w := do(joh, http.MethodGet, "/user?email=a@example.com", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want 429", w.Code)
+	}
+
+	// another client is not affected
+	r := httptest.NewRequest(http.MethodGet, "/user?email=a@example.com", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w := httptest.NewRecorder()
+	joh.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("another client: got %d, want 200", w.Code)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if w := do(joh, http.MethodGet, "/user?email=a@example.com", ""); w.Code != http.StatusOK {
+		t.Errorf("after the window: got %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestBatchGetUsers(t *testing.T) {
+	joh, _ := newTestServer(t)
+	mustRegister(t, joh, "a@example.com", "A")
+	mustRegister(t, joh, "b@example.com", "B")
+
+	w := do(joh, http.MethodPost, "/users/batch-get", `{"emails":["a@example.com","missing@example.com","b@example.com","a@example.com"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+
+	var resp batchGetResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Users) != 2 || resp.Users["a@example.com"].Name != "A" || resp.Users["b@example.com"].Name != "B" {
+		t.Errorf("users = %v", resp.Users)
+	}
+	if !slices.Equal(resp.Missing, []string{"missing@example.com"}) {
+		t.Errorf("missing = %v", resp.Missing)
+	}
+}
+
+func TestBatchGetUsersLimits(t *testing.T) {
+	joh, _ := newTestServer(t)
+
+	emails := make([]string, maxBatchSize+1)
+	for i := range emails {
+		emails[i] = "a@example.com"
+	}
+	tooMany, _ := json.Marshal(batchGetParams{Emails: emails})
+
+	for _, body := range []string{`{"emails":[]}`, string(tooMany)} {
+		if w := do(joh, http.MethodPost, "/users/batch-get", body); w.Code != http.StatusBadRequest {
+			t.Errorf("got %d, want 400", w.Code)
+		}
+	}
+}
+
+func TestHeadUser(t *testing.T) {
+	joh, _ := newTestServer(t)
+	mustRegister(t, joh, "a@example.com", "A")
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/user?email=a@example.com", http.StatusOK},
+		{"/user?email=missing@example.com", http.StatusNotFound},
+		{"/user?email=bad", http.StatusBadRequest},
+		{"/users/a@example.com", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := do(joh, http.MethodHead, tt.target, "")
+		if w.Code != tt.status {
+			t.Errorf("HEAD %s: got %d, want %d", tt.target, w.Code, tt.status)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("HEAD %s: body %q, want none", tt.target, w.Body)
+		}
+	}
+
+	if w := do(joh, http.MethodHead, "/user?email=a@example.com", ""); w.Header().Get("ETag") == "" {
+		t.Error("HEAD sent no ETag")
+	}
+}
+
+func TestListUsersByEmails(t *testing.T) {
+	joh, _ := newTestServer(t)
+	mustRegister(t, joh, "a@example.com", "A")
+	mustRegister(t, joh, "b@example.com", "B")
+
+	tests := []struct {
+		query   string
+		users   []string
+		missing []string
+	}{
+		{"email=b@example.com&email=a@example.com", []string{"b@example.com", "a@example.com"}, []string{}},
+		{"email=a@example.com&email=missing@example.com", []string{"a@example.com"}, []string{"missing@example.com"}},
+	}
+	for _, tt := range tests {
+		w := do(joh, http.MethodGet, "/users?"+tt.query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", tt.query, w.Code, w.Body)
+		}
+
+		var resp usersByEmailResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var got []string
+		for _, u := range resp.Users {
+			got = append(got, u.Email)
+		}
+		if !slices.Equal(got, tt.users) || !slices.Equal(resp.Missing, tt.missing) {
+			t.Errorf("%s: got %v missing %v, want %v missing %v", tt.query, got, resp.Missing, tt.users, tt.missing)
+		}
+	}
+
+	if w := do(joh, http.MethodGet, "/users?email=a@example.com&email=bad", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid email: got %d, want 400", w.Code)
+	}
+}
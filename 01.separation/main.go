@@ -2,11 +2,36 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/base64"
 	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alexlevn/go_simplest_restapi/idgen"
+	"github.com/alexlevn/go_simplest_restapi/linkheader"
+	"github.com/alexlevn/go_simplest_restapi/memstore"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
 )
 
 // Action Layer
@@ -16,46 +41,248 @@ var ErrUserNotFound = errors.New("User not found")
 
 // User ...
 type User struct {
+	ID    string `json:"id"`
 	Email string `json:"email"`
 	Name  string `json:"name"`
+	Phone string `json:"phone,omitempty"`
+
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	CreatedAt Timestamp `json:"created_at"`
+
+	Verified bool `json:"verified"`
+	// Version goes up on every update and is sent as the ETag
+	Version int `json:"version"`
+	// VerificationToken is stored alongside the user but never sent back
+	VerificationToken string `json:"-"`
+}
+
+// clone returns a copy of u that shares no map with it
+func (u *User) clone() *User {
+	c := *u
+	c.Metadata = maps.Clone(u.Metadata)
+	return &c
 }
 
 // UserStorer ...
 type UserStorer interface {
 	Get(ctx context.Context, email string) (*User, error)
 	Save(ctx context.Context, user *User) error
+	// Create saves a new user in one step, it returns ErrEmailExist when the
+	// email is already taken
+	Create(ctx context.Context, user *User) error
+	// Rekey moves a user to a new email and applies fn to it in one step, it
+	// may return ErrUserNotFound, ErrEmailExist or whatever fn returns
+	Rekey(ctx context.Context, oldEmail, newEmail string, fn func(*User) error) (*User, error)
+	// Update applies fn to a copy of the stored user and saves the result in
+	// one step, it may return ErrUserNotFound or whatever fn returns
+	Update(ctx context.Context, email string, fn func(*User) error) (*User, error)
+	// Delete may return an ErrUserNotFound error
+	Delete(ctx context.Context, email string) error
+	// Merge applies fn to a copy of the user at primary and the user at
+	// secondary, saves the result and deletes secondary in one step. It may
+	// return ErrUserNotFound or whatever fn returns.
+	Merge(ctx context.Context, primary, secondary string, fn func(u, from *User) error) (*User, error)
+}
+
+// Lister is implemented by storers that can list every user efficiently.
+// It is optional so UserStorer stays minimal.
+type Lister interface {
+	// List returns every user sorted by email
+	List(ctx context.Context) ([]*User, error)
 }
 
 // MemoryUserStorage ...
 type MemoryUserStorage struct {
-	store map[string]*User
+	store *memstore.Store[string, *User]
 }
 
 // NewMemoUserStorage ...
 func NewMemoUserStorage() *MemoryUserStorage {
 	return &MemoryUserStorage{
-		store: map[string]*User{},
+		store: memstore.New(func(u *User) string { return u.Email }),
 	}
 }
 
+// Get returns a copy, changing it does not change the stored user
 func (ms *MemoryUserStorage) Get(ctx context.Context, email string) (*User, error) {
-	if u, ok := ms.store[email]; ok {
-		return u, nil
+	if u, ok := ms.store.Get(email); ok {
+		return u.clone(), nil
 	}
-	return nil, ErrUserNotFound
+	return nil, fmt.Errorf("%w: %s", ErrUserNotFound, email)
 }
 
+// Save stores a copy, so the caller may keep changing user afterwards
 func (ms *MemoryUserStorage) Save(ctx context.Context, user *User) error {
-	ms.store[user.Email] = user
+	ms.store.Save(user.clone())
+	return nil
+}
+
+// Create stores a copy like Save, but never replaces an existing user
+func (ms *MemoryUserStorage) Create(ctx context.Context, user *User) error {
+	if !ms.store.Insert(user.clone()) {
+		return fmt.Errorf("%w: %s", ErrEmailExist, user.Email)
+	}
+	return nil
+}
+
+// List snapshots the store under a short read lock, sorting and encoding the
+// result happen without holding any lock. Like Get it returns copies.
+func (ms *MemoryUserStorage) List(ctx context.Context) ([]*User, error) {
+	users := ms.store.List()
+	for i, u := range users {
+		users[i] = u.clone()
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users, nil
+}
+
+func (ms *MemoryUserStorage) Rekey(ctx context.Context, oldEmail, newEmail string, fn func(*User) error) (*User, error) {
+	u, err := ms.store.Update(oldEmail, func(u *User) (*User, error) {
+		moved := u.clone()
+		if err := fn(moved); err != nil {
+			return nil, err
+		}
+
+		moved.Email = newEmail
+		return moved, nil
+	})
+	if err != nil {
+		return nil, storeError(err, oldEmail, newEmail)
+	}
+	return u.clone(), nil
+}
+
+func (ms *MemoryUserStorage) Update(ctx context.Context, email string, fn func(*User) error) (*User, error) {
+	u, err := ms.store.Update(email, func(u *User) (*User, error) {
+		updated := u.clone()
+		if err := fn(updated); err != nil {
+			return nil, err
+		}
+
+		updated.Email = email
+		return updated, nil
+	})
+	if err != nil {
+		return nil, storeError(err, email, email)
+	}
+	return u.clone(), nil
+}
+
+func (ms *MemoryUserStorage) Delete(ctx context.Context, email string) error {
+	if _, ok := ms.store.Delete(email); !ok {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, email)
+	}
 	return nil
 }
 
+func (ms *MemoryUserStorage) Merge(ctx context.Context, primary, secondary string, fn func(u, from *User) error) (*User, error) {
+	u, err := ms.store.Merge(primary, secondary, func(u, from *User) (*User, error) {
+		merged := u.clone()
+		if err := fn(merged, from.clone()); err != nil {
+			return nil, err
+		}
+
+		merged.Email = primary
+		return merged, nil
+	})
+	if errors.Is(err, memstore.ErrNotFound) {
+		if _, ok := ms.store.Get(primary); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, primary)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, secondary)
+	} else if err != nil {
+		return nil, err
+	}
+	return u.clone(), nil
+}
+
+// storeError maps the memstore errors to the ones UserStorer documents,
+// wrapped with the email they are about
+func storeError(err error, email, newEmail string) error {
+	if errors.Is(err, memstore.ErrNotFound) {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, email)
+	} else if errors.Is(err, memstore.ErrKeyExists) {
+		return fmt.Errorf("%w: %s", ErrEmailExist, newEmail)
+	}
+	return err
+}
+
 // Business Logic
 
 // RegisterParams ...
 type RegisterParams struct {
 	Email string `json:"email"`
 	Name  string `json:"name"`
+	Phone string `json:"phone,omitempty"`
+
+	// FirstName and LastName take precedence over Name when given
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// names returns the full name with its first/last parts, joining the parts
+// when given and otherwise splitting Name on its first space as a best effort
+func (rp *RegisterParams) names() (name, first, last string) {
+	first = strings.TrimSpace(rp.FirstName)
+	last = strings.TrimSpace(rp.LastName)
+
+	if first != "" || last != "" {
+		return strings.TrimSpace(first + " " + last), first, last
+	}
+
+	name = strings.TrimSpace(rp.Name)
+	first, last, _ = strings.Cut(name, " ")
+	return name, first, strings.TrimSpace(last)
+}
+
+// Limits on the custom key/values a deployment may attach to a user
+const (
+	maxMetadataKeys  = 20
+	maxMetadataBytes = 256
+)
+
+// Email length limits from RFC 5321, in octets
+const (
+	maxEmailLocalBytes = 64
+	maxEmailBytes      = 254
+)
+
+var (
+	// ErrEmailTooLong ...
+	ErrEmailTooLong = fmt.Errorf("Email cannot be longer than %d bytes", maxEmailBytes)
+	// ErrEmailLocalTooLong ...
+	ErrEmailLocalTooLong = fmt.Errorf("Email local part cannot be longer than %d bytes", maxEmailLocalBytes)
+)
+
+// checkEmailLength applies the RFC 5321 limits, which net/mail does not
+func checkEmailLength(email string) error {
+	if len(email) > maxEmailBytes {
+		return ErrEmailTooLong
+	}
+	if at := strings.LastIndexByte(email, '@'); at > maxEmailLocalBytes {
+		return ErrEmailLocalTooLong
+	}
+	return nil
+}
+
+// e164 matches a leading '+' followed by 8 to 15 digits
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// defaultName fills a missing name with the local part of the email
+func (rp *RegisterParams) defaultName() {
+	if name, _, _ := rp.names(); name != "" {
+		return
+	}
+
+	if local, _, ok := strings.Cut(rp.Email, "@"); ok {
+		rp.Name = local
+	}
 }
 
 func (rp *RegisterParams) Validate() error {
@@ -67,8 +294,28 @@ func (rp *RegisterParams) Validate() error {
 		return errors.New("Email must include an '@' symbol")
 	}
 
-	if rp.Name == "" {
-		return errors.New("Name cannot be empty")
+	if err := checkEmailLength(rp.Email); err != nil {
+		return err
+	}
+
+	if name, _, _ := rp.names(); name == "" {
+		return errors.New("Name cannot be empty, give either name or first_name/last_name")
+	}
+
+	if rp.Phone != "" && !e164.MatchString(rp.Phone) {
+		return errors.New("Phone must be in E.164 format, e.g. +84901234567")
+	}
+
+	if len(rp.Metadata) > maxMetadataKeys {
+		return fmt.Errorf("Metadata cannot have more than %d keys", maxMetadataKeys)
+	}
+	for k, v := range rp.Metadata {
+		if k == "" {
+			return errors.New("Metadata keys cannot be empty")
+		}
+		if len(k) > maxMetadataBytes || len(v) > maxMetadataBytes {
+			return fmt.Errorf("Metadata keys and values cannot be longer than %d bytes", maxMetadataBytes)
+		}
 	}
 
 	return nil
@@ -80,147 +327,973 @@ type UserService interface {
 	Register(context.Context, *RegisterParams) error
 	// GetByEmail may retturn an ErrUserNotFound error
 	GetByEmail(context.Context, string) (*User, error)
+	// List returns one page of users ordered by email, it may return an
+	// ErrListUnsupported error
+	List(context.Context, *ListParams) (*UserPage, error)
+	// Exists reports whether a user is registered under the email
+	Exists(context.Context, string) (bool, error)
+	// ChangeEmail may return an ErrUserNotFound or ErrEmailExist error
+	ChangeEmail(ctx context.Context, oldEmail, newEmail string) (*User, error)
+	// GetMany returns the users found by email plus the emails that were not
+	GetMany(ctx context.Context, emails []string) (map[string]*User, []string, error)
+	// Verify may return an ErrUserNotFound or ErrInvalidToken error
+	Verify(ctx context.Context, email, token string) (*User, error)
+	// Update may return an ErrUserNotFound or ErrVersionMismatch error
+	Update(ctx context.Context, email string, params *RegisterParams, version int) (*User, error)
+	// Reset may return an ErrUserNotFound error
+	Reset(ctx context.Context, email string) error
+	// ListByInitial may return an ErrListUnsupported error
+	ListByInitial(ctx context.Context, letter rune) ([]*User, error)
+	// DeleteMany returns how many of the users existed and were deleted
+	DeleteMany(ctx context.Context, emails []string) (int, error)
+	// DeleteMatching may return an ErrListUnsupported error
+	DeleteMatching(ctx context.Context, filter *DeleteFilter) (int, error)
+	// Merge may return an ErrUserNotFound or ErrMergeSelf error
+	Merge(ctx context.Context, primary, secondary string) (*User, error)
+	// GetOrCreate reports whether the user had to be created
+	GetOrCreate(ctx context.Context, params *RegisterParams) (*User, bool, error)
+	// StorageStats may return an ErrStatsUnsupported error
+	StorageStats(ctx context.Context) (map[string]interface{}, error)
+	// ReloadBlocklist rereads the disposable domains and returns how many
+	// there are, it may return an ErrNoBlocklist error
+	ReloadBlocklist(ctx context.Context) (int, error)
+}
+
+// ListParams ...
+type ListParams struct {
+	// After is UserPage.Next of the previous page, empty for the first page
+	After string
+	Limit int
+	// Sort is the field to order by: email, name or created_at. Empty sorts by email.
+	Sort string
+
+	// CreatedAfter and CreatedBefore are exclusive bounds, a zero time leaves that side open
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (lp *ListParams) matches(u *User) bool {
+	if !lp.CreatedAfter.IsZero() && !u.CreatedAt.After(lp.CreatedAfter) {
+		return false
+	}
+	if !lp.CreatedBefore.IsZero() && !u.CreatedAt.Before(lp.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// UserPage ...
+type UserPage struct {
+	Items []*User
+	// Next is the position to continue after, empty on the last page
+	Next string
 }
 
+// ErrListUnsupported is returned by List when the storage does not implement Lister
+var ErrListUnsupported = errors.New("Listing users is not supported by this storage")
+
 // ErrEmailExist ...
 var ErrEmailExist = errors.New("Email is already in user")
 
 // UserServiceImpl ...
 type UserServiceImpl struct {
 	userStorage UserStorer
+	ids         idgen.IDGenerator
+	audit       AuditLogger
+	sendToken   VerificationHook
+	tracer      trace.Tracer
+
+	sanitizeNames bool
+	escapeHTML    bool
+
+	mx        MXResolver
+	mxTimeout time.Duration
+
+	blocklist *Blocklist
+
+	// lookups collapses concurrent GetByEmail calls for the same email into one storage call
+	lookups singleflight.Group
+}
+
+// ServiceOption ...
+type ServiceOption func(*UserServiceImpl)
+
+// WithIDGenerator overrides the UUID generator, e.g. with a sequential one in tests
+func WithIDGenerator(g idgen.IDGenerator) ServiceOption {
+	return func(us *UserServiceImpl) {
+		us.ids = g
+	}
+}
+
+// WithAuditLogger records every successful mutation to al
+func WithAuditLogger(al AuditLogger) ServiceOption {
+	return func(us *UserServiceImpl) {
+		us.audit = al
+	}
 }
 
 // NewUserServiceImpl ...
-func NewUserServiceImpl(us UserStorer) *UserServiceImpl {
-	return &UserServiceImpl{
+func NewUserServiceImpl(us UserStorer, opts ...ServiceOption) *UserServiceImpl {
+	usi := &UserServiceImpl{
 		userStorage: us,
+		ids:         idgen.UUIDIDGen{},
+		sendToken:   undeliveredToken,
+		tracer:      otel.Tracer(tracerName),
 	}
+
+	for _, opt := range opts {
+		opt(usi)
+	}
+
+	return usi
 }
 
 // Register ...
-func (us *UserServiceImpl) Register(ctx context.Context, params *RegisterParams) error {
-	_, err := us.userStorage.Get(ctx, params.Email)
+func (us *UserServiceImpl) Register(ctx context.Context, params *RegisterParams) (err error) {
+	ctx, end := us.startSpan(ctx, "Register")
+	defer func() { end(err) }()
+
+	err = us.checkDisposable(params.Email)
+	if err != nil {
+		return err
+	}
 
-	if err == nil {
-		return ErrEmailExist
-	} else if err != ErrUserNotFound {
+	err = us.checkMX(ctx, params.Email)
+	if err != nil {
 		return err
 	}
 
-	return us.userStorage.Save(ctx, &User{
+	token := newVerificationToken()
+	name, first, last := us.sanitizedNames(params)
+
+	// Create fails on a taken email, two concurrent registrations cannot both win
+	err = us.userStorage.Create(ctx, &User{
+		ID:    us.ids.NewID(),
 		Email: params.Email,
-		Name:  params.Name,
+		Name:  name,
+		Phone: params.Phone,
+
+		FirstName: first,
+		LastName:  last,
+		Metadata:  params.Metadata,
+
+		CreatedAt: Timestamp{time.Now().UTC()},
+
+		Version:           1,
+		VerificationToken: token,
 	})
+	if err != nil {
+		return err
+	}
+
+	us.record(ctx, "register", params.Email)
+	us.sendToken(ctx, params.Email, token)
+	return nil
+}
+
+// record writes to the audit log, failures are logged but never fail the request
+func (us *UserServiceImpl) record(ctx context.Context, action, email string) {
+	if us.audit == nil {
+		return
+	}
+
+	if err := us.audit.Record(ctx, action, email, time.Now()); err != nil {
+		log.Printf("audit: unable to record %s for %s: %v", action, email, err)
+	}
 }
 
 // GetByEmail ...
-func (us *UserServiceImpl) GetByEmail(ctx context.Context, email string) (*User, error) {
-	return us.userStorage.Get(ctx, email)
+func (us *UserServiceImpl) GetByEmail(ctx context.Context, email string) (u *User, err error) {
+	ctx, end := us.startSpan(ctx, "GetByEmail")
+	defer func() { end(err) }()
+
+	// the shared call must not fail for everyone when the first caller goes away
+	shared := context.WithoutCancel(ctx)
+	v, err, _ := us.lookups.Do(email, func() (interface{}, error) {
+		return us.userStorage.Get(shared, email)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// every caller gets its own copy of the one shared result
+	return v.(*User).clone(), nil
+}
+
+// Exists ...
+func (us *UserServiceImpl) Exists(ctx context.Context, email string) (exists bool, err error) {
+	ctx, end := us.startSpan(ctx, "Exists")
+	defer func() { end(err) }()
+
+	_, err = us.userStorage.Get(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetMany ...
+func (us *UserServiceImpl) GetMany(ctx context.Context, emails []string) (found map[string]*User, missing []string, err error) {
+	ctx, end := us.startSpan(ctx, "GetMany")
+	defer func() { end(err) }()
+
+	found = map[string]*User{}
+	missing = []string{}
+
+	for _, email := range emails {
+		if _, ok := found[email]; ok {
+			continue
+		}
+
+		u, err := us.userStorage.Get(ctx, email)
+		if errors.Is(err, ErrUserNotFound) {
+			missing = append(missing, email)
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		found[email] = u
+	}
+
+	return found, missing, nil
+}
+
+// ChangeEmail ...
+func (us *UserServiceImpl) ChangeEmail(ctx context.Context, oldEmail, newEmail string) (u *User, err error) {
+	ctx, end := us.startSpan(ctx, "ChangeEmail")
+	defer func() { end(err) }()
+
+	err = us.checkDisposable(newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.checkMX(ctx, newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	// the new address is unproven until its owner verifies it
+	token := newVerificationToken()
+	u, err = us.userStorage.Rekey(ctx, oldEmail, newEmail, func(u *User) error {
+		u.Verified = false
+		u.VerificationToken = token
+		u.Version++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	us.record(ctx, "change_email", oldEmail)
+	us.sendToken(ctx, newEmail, token)
+	return u, nil
+}
+
+// List ...
+func (us *UserServiceImpl) List(ctx context.Context, params *ListParams) (page *UserPage, err error) {
+	ctx, end := us.startSpan(ctx, "List")
+	defer func() { end(err) }()
+
+	lister, ok := us.userStorage.(Lister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+
+	users, err := lister.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sortBy := params.Sort
+	if sortBy == "" {
+		sortBy = "email"
+	}
+	sorted, err := sortUsers(users, sortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	afterKey, afterEmail := parseListPosition(params.After)
+	start := sort.Search(len(sorted), func(i int) bool { return sorted[i].after(afterKey, afterEmail) })
+
+	filtered := make([]sortedUser, 0, len(sorted)-start)
+	for _, su := range sorted[start:] {
+		if params.matches(su.user) {
+			filtered = append(filtered, su)
+		}
+	}
+
+	page = &UserPage{Items: make([]*User, 0, min(len(filtered), params.Limit))}
+	for _, su := range filtered[:min(len(filtered), params.Limit)] {
+		page.Items = append(page.Items, su.user)
+	}
+	if len(filtered) > params.Limit {
+		page.Next = listPosition(filtered[params.Limit-1])
+	}
+
+	return page, nil
 }
 
 // Access Layer
 
+const (
+	serviceName    = "users"
+	serviceVersion = "1.0.0"
+)
+
 // JsonOverHTTP ...
 type JsonOverHTTP struct {
-	router  *http.ServeMux
-	usrServ UserService
+	router    *http.ServeMux
+	usrServ   UserService
+	welcome   string
+	endpoints []string
+
+	strictVerify bool
+	lenient      bool
+	envelope     bool
+	maintenance  *Maintenance
+	health       *HealthRegistry
+
+	// registerLimiter is a global cap on registrations, shared by every client
+	registerLimiter *rate.Limiter
+	// lockout throttles clients probing for registered emails
+	lockout        *Lockout
+	trustedProxies []*net.IPNet
+
+	// disabled holds the route patterns that are not registered at all
+	disabled map[string]bool
+
+	// emailExistStatus answers a registration for a taken email, 403 by default
+	emailExistStatus int
+
+	validationRules ValidationRules
+	// bodyLimits applies to every JSON request body
+	bodyLimits      jsonbody.Limits
+	timestampFormat TimestampFormat
+
+	defaultTimeout time.Duration
+	routeTimeouts  map[string]time.Duration
+
+	// defaultSort orders GET /users when the client gives no ?sort=
+	defaultSort string
+
+	// recent tracks the last emails looked up by clients, nil when off
+	recent *RecentLookups
+
+	// adminToken guards the /admin routes, which are left out when it is empty
+	adminToken string
+
+	// dumpStore backs GET /debug/dump, which is only registered in dev mode
+	dumpStore Lister
+	debugDeps bool
+}
+
+// HTTPOption ...
+type HTTPOption func(*JsonOverHTTP)
+
+// WithWelcome sets the message shown by the GET / index
+func WithWelcome(msg string) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.welcome = msg
+	}
+}
+
+// WithLenientNames lets a registration without a name default to the local
+// part of the email instead of failing validation. Meant for demos.
+func WithLenientNames() HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.lenient = true
+	}
+}
+
+// WithMaintenance exposes m on POST /admin/maintenance
+func WithMaintenance(m *Maintenance) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.maintenance = m
+	}
+}
+
+// WithEmailExistStatus changes the status for registering a taken email from
+// 403 to e.g. 409 Conflict
+func WithEmailExistStatus(code int) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.emailExistStatus = code
+	}
+}
+
+// WithBodyLimits replaces jsonbody.DefaultLimits for the JSON request bodies
+// the server accepts
+func WithBodyLimits(limits jsonbody.Limits) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.bodyLimits = limits
+	}
+}
+
+// WithDisabledRoutes leaves out the routes registered under the given
+// patterns, e.g. "/register", so they answer 404. Useful for a read-only replica.
+func WithDisabledRoutes(patterns ...string) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		if j.disabled == nil {
+			j.disabled = map[string]bool{}
+		}
+		for _, p := range patterns {
+			j.disabled[p] = true
+		}
+	}
+}
+
+// WithDefaultSort orders the user list by field, one of email, name or
+// created_at, unless a request asks for another with ?sort=
+func WithDefaultSort(field string) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.defaultSort = field
+	}
+}
+
+// WithRegisterLimit caps registrations across all clients at r per second
+// with the given burst, protecting downstream services such as email
+func WithRegisterLimit(r rate.Limit, burst int) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.registerLimiter = rate.NewLimiter(r, burst)
+	}
 }
 
 // NewJSONOverHTTP ..
-func NewJSONOverHTTP(usrServ UserService) *JsonOverHTTP {
+func NewJSONOverHTTP(usrServ UserService, opts ...HTTPOption) *JsonOverHTTP {
 	r := http.NewServeMux()
 
 	joh := &JsonOverHTTP{
 		router:  r,
 		usrServ: usrServ,
+		welcome: "Separate server register & get user!",
+
+		emailExistStatus: http.StatusForbidden,
+		bodyLimits:       jsonbody.DefaultLimits,
 	}
 
-	r.HandleFunc("/register", joh.Register)
-	r.HandleFunc("/user", joh.GetUser)
+	for _, opt := range opts {
+		opt(joh)
+	}
+
+	joh.handle("/register", joh.Register, "POST /register")
+	joh.handle("/register/check", joh.CheckRegister, "GET /register/check?email=")
+	joh.handle("/verify", joh.Verify, "POST /verify")
+	joh.handle("/user", joh.GetUser, "GET /user?email=", "HEAD /user?email=", "PUT /user?email=")
+	joh.handle("/user/", joh.ChangeEmail, "POST /user/{email}/email")
+	joh.handle("/users", joh.ListUsers, "GET /users?cursor=&limit=&sort=&created_after=&created_before=", "GET /users?email=&email=")
+	joh.handle("/users/batch-get", joh.BatchGetUsers, "POST /users/batch-get")
+	joh.handleAdmin("/users/bulk-delete", joh.BulkDeleteUsers, "POST /users/bulk-delete")
+	joh.handle("/users/merge", joh.MergeUsers, "POST /users/merge")
+	joh.handle("/users/get-or-create", joh.GetOrCreateUser, "POST /users/get-or-create")
+	joh.handle("/users/index/", joh.ListUsersByLetter, "GET /users/index/{letter}")
+	joh.handle("/users/", joh.GetUserByEmail, "GET /users/{email}", "HEAD /users/{email}")
+	joh.handle("/healthz", joh.Healthz, "GET /healthz")
+	if joh.health != nil {
+		joh.handle("/readyz", joh.Readyz, "GET /readyz")
+	}
+	if joh.maintenance != nil {
+		joh.handleAdmin("/admin/maintenance", joh.SetMaintenance, "GET /admin/maintenance", "POST /admin/maintenance")
+	}
+	joh.handleAdmin("/admin/user/", joh.ResetUser, "POST /admin/user/{email}/reset")
+	joh.handleAdmin("/admin/storage/stats", joh.StorageStats, "GET /admin/storage/stats")
+	if joh.recent != nil {
+		joh.handleAdmin("/admin/recent-lookups", joh.RecentLookups, "GET /admin/recent-lookups")
+	}
+	joh.handleAdmin("/admin/disposable-domains/reload", joh.ReloadBlocklist, "POST /admin/disposable-domains/reload")
+	if joh.dumpStore != nil {
+		joh.handle("/debug/dump", joh.DebugDump, "GET /debug/dump")
+	}
+	if joh.debugDeps {
+		joh.handle("/debug/deps", joh.DebugDeps, "GET /debug/deps")
+	}
+	joh.handle("/", joh.Index, "GET /")
 
 	return joh
 }
 
+// handle registers h on pattern and lists its endpoints in the GET / index
+func (j *JsonOverHTTP) handle(pattern string, h http.HandlerFunc, endpoints ...string) {
+	if j.disabled[pattern] {
+		// a 404 of its own keeps a broader pattern such as /users/ from serving it
+		j.router.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			j.writeError(w, r, "404 page not found", http.StatusNotFound)
+		})
+		return
+	}
+	if d := j.timeoutFor(pattern); d > 0 {
+		h = j.withTimeout(h, d)
+	}
+	j.router.HandleFunc(pattern, h)
+	j.endpoints = append(j.endpoints, endpoints...)
+}
+
 func (j *JsonOverHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	j.router.ServeHTTP(w, r)
 }
 
+type indexResponse struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	Message   string   `json:"message,omitempty"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// Index lists the available endpoints for basic API discovery
+func (j *JsonOverHTTP) Index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		j.writeError(w, r, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		j.writeError(w, r, "Index requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, indexResponse{
+		Name:      serviceName,
+		Version:   serviceVersion,
+		Message:   j.welcome,
+		Endpoints: j.endpoints,
+	})
+}
+
+// Healthz ...
+func (j *JsonOverHTTP) Healthz(w http.ResponseWriter, r *http.Request) {
+	j.writeJSON(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+type maintenanceParams struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetMaintenance reports maintenance mode on GET and switches it on POST
+func (j *JsonOverHTTP) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		params := &maintenanceParams{}
+		err := jsonbody.Decode(w, r, params, j.bodyLimits)
+
+		if err != nil {
+			j.writeJSONError(w, r, err)
+			return
+		}
+
+		j.maintenance.Set(params.Enabled)
+	default:
+		j.writeError(w, r, "SetMaintenance requires a get or post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, maintenanceParams{Enabled: j.maintenance.Enabled()})
+}
+
 // Register ...
 func (j *JsonOverHTTP) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Register requires a post request", http.StatusMethodNotAllowed)
+		j.writeError(w, r, "Register requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if j.registerLimiter != nil && !j.registerLimiter.Allow() {
+		w.Header().Set("Retry-After", "1")
+		j.writeError(w, r, "Too many registrations, please try again later", http.StatusTooManyRequests)
 		return
 	}
 
 	params := &RegisterParams{}
-	err := json.NewDecoder(r.Body).Decode(params)
+	var err error
+	if isForm(r) {
+		err = decodeRegisterForm(w, r, params, j.bodyLimits.MaxBytes)
+	} else {
+		err = jsonbody.Decode(w, r, params, j.bodyLimits)
+	}
 
 	if err != nil {
-		http.Error(w, "Unable to read your request", http.StatusBadRequest)
+		j.writeJSONError(w, r, err)
 		return
 	}
 
-	err = params.Validate()
+	if j.lenient {
+		params.defaultName()
+	}
+
+	err = j.validationRules.validate(params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		j.writeError(w, r, err.Error(), validationStatus(err))
 		return
 	}
 
 	err = j.usrServ.Register(r.Context(), params)
 
-	if err == ErrEmailExist {
-		http.Error(w, err.Error(), http.StatusForbidden)
+	if errors.Is(err, ErrEmailExist) && r.Header.Get("If-None-Match") == "*" {
+		// a conditional create that failed its condition
+		j.writeError(w, r, err.Error(), http.StatusPreconditionFailed)
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		j.writeJSONError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
 }
 
-func (j *JsonOverHTTP) validateEmail(email string) error {
-	if email == "" {
-		return errors.New("Email must not be empty")
+// CheckRegister reports whether an email is free to register without creating the user
+func (j *JsonOverHTTP) CheckRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		j.writeError(w, r, "CheckRegister requires a get request", http.StatusMethodNotAllowed)
+		return
 	}
 
-	if !strings.ContainsRune(email, '@') {
-		return errors.New("Email must include an '@' sympol")
+	if j.lockedOut(w, r) {
+		return
 	}
 
-	return nil
-}
-
-// GetUser ...
+	email := r.FormValue("email")
+	err := j.validateEmail(email)
+
+	if err != nil {
+		j.writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists, err := j.usrServ.Exists(r.Context(), email)
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+	if !exists {
+		j.failLookup(r)
+	}
+
+	j.writeJSON(w, r, http.StatusOK, map[string]bool{"available": !exists})
+}
+
+func (j *JsonOverHTTP) validateEmail(email string) error {
+	if email == "" {
+		return errors.New("Email must not be empty")
+	}
+
+	if !strings.ContainsRune(email, '@') {
+		return errors.New("Email must include an '@' sympol")
+	}
+
+	return checkEmailLength(email)
+}
+
+// GetUser handles GET and HEAD /user?email=, PUT is passed on to UpdateUser
 func (j *JsonOverHTTP) GetUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "GetUser requires a get request", http.StatusMethodNotAllowed)
+	if r.Method == http.MethodPut {
+		j.UpdateUser(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		j.writeError(w, r, "GetUser requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	j.serveUser(w, r, r.FormValue("email"))
+}
+
+// GetUserByEmail handles GET and HEAD /users/{email}
+func (j *JsonOverHTTP) GetUserByEmail(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimPrefix(r.URL.Path, "/users/")
+	if email == "" || strings.Contains(email, "/") {
+		j.writeError(w, r, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		j.writeError(w, r, "GetUserByEmail requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	j.serveUser(w, r, email)
+}
+
+// serveUser writes the user as JSON, or only the status for a HEAD request
+func (j *JsonOverHTTP) serveUser(w http.ResponseWriter, r *http.Request, email string) {
+	if j.lockedOut(w, r) {
 		return
 	}
 
-	email := r.FormValue("email")
 	err := j.validateEmail(email)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		j.writeError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if j.recent != nil {
+		j.recent.Add(email, time.Now())
+	}
+
 	u, err := j.usrServ.GetByEmail(r.Context(), email)
 
-	if err == ErrUserNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if errors.Is(err, ErrUserNotFound) {
+		j.failLookup(r)
+		j.writeError(w, r, err.Error(), http.StatusNotFound)
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	if j.strictVerify && !u.Verified {
+		j.writeError(w, r, ErrNotVerified.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("ETag", etag(u))
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, u)
+}
+
+type changeEmailParams struct {
+	NewEmail string `json:"new_email"`
+}
+
+// ChangeEmail handles POST /user/{email}/email
+func (j *JsonOverHTTP) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimPrefix(r.URL.Path, "/user/")
+	if !strings.HasSuffix(email, "/email") {
+		j.writeError(w, r, "404 page not found", http.StatusNotFound)
+		return
+	}
+	email = strings.TrimSuffix(email, "/email")
+
+	if r.Method != http.MethodPost {
+		j.writeError(w, r, "ChangeEmail requires a post request", http.StatusMethodNotAllowed)
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(u)
+	if j.lockedOut(w, r) {
+		return
+	}
+
+	params := &changeEmailParams{}
+	err := jsonbody.Decode(w, r, params, j.bodyLimits)
+
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	err = j.validateEmail(params.NewEmail)
+	if err != nil {
+		j.writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = j.validationRules.checkEmail(params.NewEmail)
+	if err != nil {
+		j.writeError(w, r, err.Error(), validationStatus(err))
+		return
+	}
+
+	u, err := j.usrServ.ChangeEmail(r.Context(), email, params.NewEmail)
+
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrEmailExist) {
+		// either answer tells the client whether an email is taken
+		j.failLookup(r)
+	}
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, u)
+}
+
+// maxBatchSize caps how many emails one batch-get may ask for
+const maxBatchSize = 100
+
+type batchGetParams struct {
+	Emails []string `json:"emails"`
+}
+
+type batchGetResponse struct {
+	Users   map[string]*User `json:"users"`
+	Missing []string         `json:"missing"`
+}
+
+// BatchGetUsers ...
+func (j *JsonOverHTTP) BatchGetUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		j.writeError(w, r, "BatchGetUsers requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := &batchGetParams{}
+	err := jsonbody.Decode(w, r, params, j.bodyLimits)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	if len(params.Emails) == 0 {
+		j.writeError(w, r, "Emails cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if len(params.Emails) > maxBatchSize {
+		j.writeError(w, r, "Too many emails in one batch", http.StatusBadRequest)
+		return
+	}
+
+	if j.lockedOut(w, r) {
+		return
+	}
+
+	users, missing, err := j.usrServ.GetMany(r.Context(), params.Emails)
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+	for range missing {
+		j.failLookup(r)
+	}
+
+	j.writeJSON(w, r, http.StatusOK, batchGetResponse{Users: users, Missing: missing})
+}
+
+type usersByEmailResponse struct {
+	Users   []*User  `json:"users"`
+	Missing []string `json:"missing"`
+}
+
+// listByEmails handles GET /users?email=a@x.com&email=b@x.com
+func (j *JsonOverHTTP) listByEmails(w http.ResponseWriter, r *http.Request, emails []string) {
+	if len(emails) > maxBatchSize {
+		j.writeError(w, r, "Too many emails in one request", http.StatusBadRequest)
+		return
+	}
+
+	for _, email := range emails {
+		if err := j.validateEmail(email); err != nil {
+			j.writeError(w, r, email+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if j.lockedOut(w, r) {
+		return
+	}
+
+	found, missing, err := j.usrServ.GetMany(r.Context(), emails)
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+	for range missing {
+		j.failLookup(r)
+	}
+
+	resp := usersByEmailResponse{Users: []*User{}, Missing: missing}
+	for _, email := range emails {
+		if u, ok := found[email]; ok {
+			resp.Users = append(resp.Users, u)
+			delete(found, email)
+		}
+	}
+
+	j.writeJSON(w, r, http.StatusOK, resp)
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type userListResponse struct {
+	Items      []*User `json:"items"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+// ListUsers ...
+func (j *JsonOverHTTP) ListUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		j.writeError(w, r, "ListUsers requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if emails := r.URL.Query()["email"]; len(emails) > 0 {
+		j.listByEmails(w, r, emails)
 		return
 	}
+
+	params := &ListParams{Limit: defaultPageSize, Sort: r.FormValue("sort")}
+	if params.Sort == "" {
+		params.Sort = j.defaultSort
+	}
+
+	if cursor := r.FormValue("cursor"); cursor != "" {
+		after, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			j.writeError(w, r, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		params.After = string(after)
+	}
+
+	if limit := r.FormValue("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			j.writeError(w, r, "Limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		params.Limit = n
+	}
+
+	for name, bound := range map[string]*time.Time{
+		"created_after":  &params.CreatedAfter,
+		"created_before": &params.CreatedBefore,
+	} {
+		v := r.FormValue(name)
+		if v == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			j.writeError(w, r, name+" must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		*bound = t
+	}
+
+	page, err := j.usrServ.List(r.Context(), params)
+	if errors.Is(err, ErrListUnsupported) && !j.envelope {
+		writeJSON(w, r, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+		return
+	} else if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	resp := userListResponse{Items: page.Items}
+	// a cursor only leads forward, so there are no prev and last links
+	links := []linkheader.Link{{URL: linkheader.WithQuery(r.URL, map[string]string{"cursor": ""}), Rel: "first"}}
+	if page.Next != "" {
+		resp.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(page.Next))
+		links = append(links, linkheader.Link{URL: linkheader.WithQuery(r.URL, map[string]string{"cursor": resp.NextCursor}), Rel: "next"})
+	}
+	w.Header().Set("Link", linkheader.Format(links))
+
+	j.writeJSON(w, r, http.StatusOK, resp)
 }
 
 // Wire together
@@ -228,9 +1301,11 @@ func (j *JsonOverHTTP) GetUser(w http.ResponseWriter, r *http.Request) {
 func main() {
 	println("Separate server register & get user!")
 
-	usrStor := NewMemoUserStorage()
-	usrServ := NewUserServiceImpl(usrStor)
-	joh := NewJSONOverHTTP(usrServ)
+	shutdownTracing, err := setupTracing()
+	if err != nil {
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
 
 	port := os.Getenv("PORT")
 
@@ -238,21 +1313,509 @@ func main() {
 		port = "8080"
 	}
 
-	err := http.ListenAndServe(":"+port, joh)
+	shutdownDefault := 10 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		shutdownDefault, err = time.ParseDuration(v)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	addr := flag.String("addr", ":"+port, `listen address, or "unix:/path/to.sock" for a Unix socket`)
+	storePath := flag.String("store", "", "JSON file to keep users in, in-memory only when empty")
+	dev := flag.Bool("dev", false, "local development mode, exposes GET /debug/dump with every user and GET /debug/deps; never use in production")
+	logBodies := flag.Bool("log-bodies", false, "with -dev, log request and response bodies with passwords and tokens redacted")
+	replicaPath := flag.String("replica", "", "JSON file every write is also mirrored to in the background")
+	seedPath := flag.String("seed", "", "JSON file with an array of users to register at startup")
+	maxHeaderBytes := flag.Int("max-header-bytes", defaultMaxHeaderBytes, "largest request header block accepted, in bytes")
+	useH2C := flag.Bool("h2c", false, "also accept cleartext HTTP/2 (h2c), e.g. behind a proxy")
+	var tlsSettings TLSSettings
+	flag.StringVar(&tlsSettings.CertFile, "tls-cert", "", "certificate file, serves HTTPS when given with -tls-key")
+	flag.StringVar(&tlsSettings.KeyFile, "tls-key", "", "private key file for -tls-cert")
+	flag.StringVar(&tlsSettings.MinVersion, "tls-min-version", "1.2", "minimum TLS version, 1.2 or 1.3")
+	tlsCiphers := flag.String("tls-ciphers", "", "comma separated TLS 1.2 cipher suites, Go's defaults when empty")
+	reapInterval := flag.Duration("reap-interval", time.Minute, "how often expired lockout entries are cleared out")
+	shutdownTimeout := flag.Duration("shutdown-timeout", shutdownDefault, "how long to drain in-flight requests before closing them")
+	readyTimeout := flag.Duration("ready-timeout", 5*time.Second, "how long to wait for the storage to become ready at startup")
+	bodyLimits := jsonbody.DefaultLimits
+	flag.Int64Var(&bodyLimits.MaxBytes, "max-body-bytes", bodyLimits.MaxBytes, "largest JSON request body accepted, in bytes")
+	flag.IntVar(&bodyLimits.MaxDepth, "max-body-depth", bodyLimits.MaxDepth, "deepest object/array nesting accepted in a JSON request body, 0 for no limit")
+	flag.BoolVar(&bodyLimits.RequireUTF8, "require-utf8", bodyLimits.RequireUTF8, "reject JSON request bodies that are not valid UTF-8")
+	flag.Parse()
+
+	var usrStor UserStorer = NewMemoUserStorage()
+	if *storePath != "" {
+		fs, err := NewFileUserStorage(*storePath)
+		if err != nil {
+			panic(err)
+		}
+		usrStor = fs
+	}
+	if *replicaPath != "" {
+		replica, err := NewFileUserStorage(*replicaPath)
+		if err != nil {
+			panic(err)
+		}
+		usrStor = NewDualWriteUserStorage(usrStor, replica, 1024, nil)
+	}
+
+	validationRules, err := ValidationRulesFromEnv(os.Getenv)
+	if err != nil {
+		panic(err)
+	}
+
+	var servOpts []ServiceOption
+	switch os.Getenv("SANITIZE_NAMES") {
+	case "strip":
+		servOpts = append(servOpts, WithSanitizedNames(false))
+	case "escape":
+		servOpts = append(servOpts, WithSanitizedNames(true))
+	}
+	if path := os.Getenv("DISPOSABLE_DOMAINS_FILE"); path != "" || os.Getenv("BLOCK_DISPOSABLE") == "true" {
+		source := EmbeddedDomains
+		if path != "" {
+			source = DomainFile(path)
+		}
+		bl, err := NewBlocklist(source)
+		if err != nil {
+			panic(err)
+		}
+		servOpts = append(servOpts, WithBlocklist(bl))
+	}
+	if url := os.Getenv("VERIFICATION_WEBHOOK"); url != "" {
+		servOpts = append(servOpts, WithVerificationHook(WebhookVerificationHook(url, &http.Client{Timeout: 5 * time.Second})))
+	} else if *dev {
+		log.Printf("WARN dev mode: verification tokens are logged in plain text")
+		servOpts = append(servOpts, WithVerificationHook(logVerificationToken))
+	}
+	if os.Getenv("CHECK_MX") == "true" {
+		servOpts = append(servOpts, WithMXCheck(net.DefaultResolver, 2*time.Second))
+	}
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		servOpts = append(servOpts, WithAuditLogger(NewJSONAuditLogger(f)))
+	}
+
+	usrServ := NewUserServiceImpl(usrStor, servOpts...)
+
+	httpOpts := []HTTPOption{WithValidationRules(validationRules), WithBodyLimits(bodyLimits)}
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		httpOpts = append(httpOpts, WithAdminToken(token))
+	}
+	if v := os.Getenv("RECENT_LOOKUPS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			panic(err)
+		}
+		if n > 0 {
+			httpOpts = append(httpOpts, WithRecentLookups(n))
+		}
+	}
+	if *dev {
+		httpOpts = append(httpOpts, WithDebugDeps())
+		if l, ok := usrStor.(Lister); ok {
+			log.Printf("WARN dev mode: GET /debug/dump exposes every user")
+			httpOpts = append(httpOpts, WithDebugDump(l))
+		}
+	}
+	if os.Getenv("TIMESTAMP_FORMAT") == "unix" {
+		httpOpts = append(httpOpts, WithTimestampFormat(TimestampUnix))
+	}
+	if msg := os.Getenv("WELCOME"); msg != "" {
+		httpOpts = append(httpOpts, WithWelcome(msg))
+	}
+	if os.Getenv("STRICT_VERIFY") == "true" {
+		httpOpts = append(httpOpts, WithStrictVerification())
+	}
+	if os.Getenv("LENIENT") == "true" {
+		httpOpts = append(httpOpts, WithLenientNames())
+	}
+	if field := os.Getenv("USERS_DEFAULT_SORT"); field != "" {
+		if _, ok := userSortKeys[field]; !ok {
+			panic(ErrUnknownSort)
+		}
+		httpOpts = append(httpOpts, WithDefaultSort(field))
+	}
+	if os.Getenv("DUPLICATE_EMAIL_STATUS") == "409" {
+		httpOpts = append(httpOpts, WithEmailExistStatus(http.StatusConflict))
+	}
+	if os.Getenv("ENVELOPE") == "true" {
+		httpOpts = append(httpOpts, WithEnvelope())
+	}
+
+	if v := os.Getenv("REGISTER_RATE"); v != "" {
+		perSecond, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			panic(err)
+		}
+		burst, _ := strconv.Atoi(os.Getenv("REGISTER_BURST"))
+		if burst < 1 {
+			burst = 1
+		}
+		httpOpts = append(httpOpts, WithRegisterLimit(rate.Limit(perSecond), burst))
+	}
+
+	trustedProxies, err := ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		panic(err)
+	}
+	httpOpts = append(httpOpts, WithTrustedProxies(trustedProxies))
+
+	// sweepers hold expiring entries, the reaper clears them out in the background
+	var sweepers []Sweeper
+	if v := os.Getenv("LOOKUP_LOCKOUT"); v != "" {
+		threshold, err := strconv.Atoi(v)
+		if err != nil || threshold < 1 {
+			panic("LOOKUP_LOCKOUT must be a positive number")
+		}
+		window := time.Minute
+		if v := os.Getenv("LOOKUP_LOCKOUT_WINDOW"); v != "" {
+			window, err = time.ParseDuration(v)
+			if err != nil {
+				panic(err)
+			}
+		}
+		lockout := NewLockout(threshold, window)
+		httpOpts = append(httpOpts, WithLookupLockout(lockout))
+		sweepers = append(sweepers, lockout)
+	}
+
+	var defaultTimeout time.Duration
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		defaultTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			panic(err)
+		}
+	}
+	routeTimeouts, err := ParseRouteTimeouts(os.Getenv("ROUTE_TIMEOUTS"))
+	if err != nil {
+		panic(err)
+	}
+	httpOpts = append(httpOpts, WithTimeouts(defaultTimeout, routeTimeouts))
+
+	var disabledRoutes []string
+	if v := os.Getenv("DISABLED_ROUTES"); v != "" {
+		disabledRoutes = strings.Split(v, ",")
+		httpOpts = append(httpOpts, WithDisabledRoutes(disabledRoutes...))
+	}
+
+	maint := &Maintenance{}
+	httpOpts = append(httpOpts, WithMaintenance(maint))
+
+	err = WaitForReady(context.Background(), storageHealth{us: usrStor}, *readyTimeout)
 	if err != nil {
 		panic(err)
 	}
 
+	if *seedPath != "" {
+		loaded, skipped, err := seedUsers(context.Background(), usrServ, validationRules, *seedPath)
+		if err != nil {
+			panic(err)
+		}
+		log.Printf("seed: registered %d users, skipped %d", loaded, skipped)
+	}
+
+	health := &HealthRegistry{}
+	health.Register(storageHealth{us: usrStor})
+	httpOpts = append(httpOpts, WithHealthRegistry(health))
+
+	joh := NewJSONOverHTTP(usrServ, httpOpts...)
+
+	slashMode := SlashRewrite
+	if os.Getenv("TRAILING_SLASH") == "redirect" {
+		slashMode = SlashRedirect
+	}
+
+	mux := http.NewServeMux()
+	if !slices.Contains(disabledRoutes, "/rpc") {
+		mux.Handle("/rpc", NewJSONRPCServer(joh))
+	}
+	mux.Handle("/", joh)
+
+	var handler http.Handler = maint.Middleware(mux)
+	if v := os.Getenv("API_VERSIONS"); v != "" {
+		handler = RequireVersion(handler, strings.Split(v, ","), healthPath)
+	}
+	handler = StripSlashes(handler, slashMode)
+	handler = RecoverMiddleware(handler, nil)
+
+	if v := os.Getenv("MAX_INFLIGHT"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 {
+			panic("MAX_INFLIGHT must be a positive number")
+		}
+		var wait time.Duration
+		if v := os.Getenv("MAX_INFLIGHT_WAIT"); v != "" {
+			wait, err = time.ParseDuration(v)
+			if err != nil {
+				panic(err)
+			}
+		}
+		handler = ConcurrencyLimit(handler, size, wait)
+	}
+
+	slow := time.Second
+	if v := os.Getenv("SLOW_REQUEST_THRESHOLD"); v != "" {
+		slow, err = time.ParseDuration(v)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if *dev && *logBodies {
+		handler = BodyLog(handler, nil, 2048, bodyLimits.MaxBytes)
+	} else if *logBodies {
+		log.Printf("WARN -log-bodies is ignored without -dev")
+	}
+	handler = AccessLog(handler, nil, slow, trustedProxies)
+	handler = RequestID(handler, idgen.UUIDIDGen{})
+	handler = otelhttp.NewHandler(handler, serviceName)
+
+	if origins := os.Getenv("CORS_ORIGINS"); origins != "" {
+		maxAge, _ := strconv.Atoi(os.Getenv("CORS_MAX_AGE"))
+		handler = CORS(handler, CORSConfig{
+			AllowedOrigins:   strings.Split(origins, ","),
+			MaxAge:           maxAge,
+			AllowCredentials: os.Getenv("CORS_CREDENTIALS") == "true",
+		})
+	}
+
+	if *useH2C {
+		// HTTP/1.1 requests are passed through untouched
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	server := newServer(handler, *maxHeaderBytes)
+	conns := trackConns(server)
+	if tlsSettings.Enabled() {
+		if *tlsCiphers != "" {
+			tlsSettings.CipherSuites = strings.Split(*tlsCiphers, ",")
+		}
+		server.TLSConfig, err = tlsSettings.Config()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	ln, cleanup, err := listen(*addr)
+	if err != nil {
+		panic(err)
+	}
+	defer cleanup()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var reaperDone <-chan struct{}
+	if len(sweepers) > 0 {
+		reaperDone = runReaper(ctx, *reapInterval, sweepers...)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			errc <- server.ServeTLS(ln, tlsSettings.CertFile, tlsSettings.KeyFile)
+			return
+		}
+		errc <- server.Serve(ln)
+	}()
+
+	select {
+	case err = <-errc:
+		panic(err)
+	case <-ctx.Done():
+	}
+
+	drain(server, conns, *shutdownTimeout)
+	if reaperDone != nil {
+		<-reaperDone
+	}
+
+	if f, ok := usrStor.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			log.Printf("shutdown: unable to flush storage: %v", err)
+		}
+	}
+
 }
 
 /*
 TEST
+	List the available endpoints
+	~ curl localhost:8080/
+
 	Register
-	~ curl -XPOST -d '{"email":"thanhdungfb@gmail.com", "Name":"Alex Lee"}' localhost:8080/register
+	~ curl -XPOST -H 'Content-Type: application/json' -d '{"email":"thanhdungfb@gmail.com", "Name":"Alex Lee"}' localhost:8080/register
+	~ curl -XPOST -H 'Content-Type: application/json' -d '{"email":"minh@example.com", "first_name":"Minh", "last_name":"Le"}' localhost:8080/register
+	~ curl -XPOST -H 'Content-Type: application/json' -d '{"email":"lan@example.com", "name":"Lan", "metadata":{"team":"sales"}}' localhost:8080/register
+	DUPLICATE_EMAIL_STATUS=409 answers a taken email with 409 Conflict instead of 403
+
+	Register only if the user does not exist yet, 412 instead of 403 when it does
+	~ curl -XPOST -H 'If-None-Match: *' -H 'Content-Type: application/json' -d '{"email":"thanhdungfb@gmail.com", "Name":"Alex Lee"}' localhost:8080/register
+
+	Register from a form body, JSON is used for any other content type
+	~ curl -XPOST -d 'email=an@example.com&name=An&metadata[team]=ops' localhost:8080/register
+	NAME_MIN_LENGTH/NAME_MAX_LENGTH bound the name, REQUIRE_PHONE=true makes the phone mandatory,
+	ALLOWED_DOMAINS restricts signups to the listed email domains and their subdomains, others get 422
+	~ ALLOWED_DOMAINS=example.com,example.org REQUIRE_PHONE=true go run .
+	BLOCK_DISPOSABLE=true rejects throwaway email domains with 422, DISPOSABLE_DOMAINS_FILE replaces the built-in list
+	~ DISPOSABLE_DOMAINS_FILE=disposable_domains.txt go run .
+	~ curl -H "Authorization: Bearer $ADMIN_TOKEN" -XPOST localhost:8080/admin/disposable-domains/reload
+	CHECK_MX=true also rejects emails whose domain has no MX records
+	SANITIZE_NAMES=strip drops control characters from names, SANITIZE_NAMES=escape also HTML-escapes them
+	With LENIENT=true the name may be left out and defaults to the local part of the email
+	~ curl -XPOST -H 'Content-Type: application/json' -d '{"email":"hung@example.com"}' localhost:8080/register
+
+	Verify the email with the token sent at registration (STRICT_VERIFY=true hides unverified users)
+	~ curl -XPOST -d '{"email":"thanhdungfb@gmail.com", "token":"<token>"}' localhost:8080/verify
+	Tokens are POSTed as {"email","token"} to VERIFICATION_WEBHOOK; without one they are only logged in plain text with -dev
+	~ VERIFICATION_WEBHOOK=http://localhost:9000/send-token go run .
+
+	Check a user exists without fetching the body
+	~ curl -I localhost:8080/user\?email=thanhdungfb@gmail.com
+	~ curl -I localhost:8080/users/thanhdungfb@gmail.com
+
+	Check an email is still available before registering
+	~ curl localhost:8080/register/check\?email=thanhdungfb@gmail.com
 
 	Get Detail User
 	~ curl localhost:8080/user\?email=thanhdungfb@gmail.com
 
+	Update a user, If-Match must carry the ETag from the last GET (412 when stale)
+	~ curl -XPUT -H 'If-Match: "1"' -d '{"name":"Alex Le"}' localhost:8080/user\?email=thanhdungfb@gmail.com
+
+	Change a user's email
+	~ curl -XPOST -d '{"new_email":"alex@example.com"}' localhost:8080/user/thanhdungfb@gmail.com/email
+
+	Get several users at once
+	~ curl -XPOST -d '{"emails":["thanhdungfb@gmail.com","nobody@example.com"]}' localhost:8080/users/batch-get
+
+	Get several users by repeating the email query param
+	~ curl localhost:8080/users\?email=thanhdungfb@gmail.com\&email=nobody@example.com
+
+	Delete several users, by email or by a name filter, with the admin token
+	~ curl -H "Authorization: Bearer $ADMIN_TOKEN" -XPOST -d '{"emails":["thanhdungfb@gmail.com"]}' localhost:8080/users/bulk-delete
+	~ curl -H "Authorization: Bearer $ADMIN_TOKEN" -XPOST -d '{"name_contains":"test"}' localhost:8080/users/bulk-delete
+
+	Call the user service over JSON-RPC 2.0 (user.register and user.get)
+	~ curl -XPOST -d '{"jsonrpc":"2.0", "method":"user.get", "params":{"email":"thanhdungfb@gmail.com"}, "id":1}' localhost:8080/rpc
+
+	Get a user, registering it first when the email is new (200 found, 201 created)
+	~ curl -XPOST -d '{"email":"thanhdungfb@gmail.com", "name":"Alex Lee"}' localhost:8080/users/get-or-create
+
+	Merge a duplicate user into another, filling only the fields that are empty
+	~ curl -XPOST -d '{"primary_email":"thanhdungfb@gmail.com", "secondary_email":"alex@example.com"}' localhost:8080/users/merge
+
+	List Users, one page at a time (pass next_cursor back as cursor, or follow the Link header)
+	~ curl -i localhost:8080/users\?limit=10
+	Sorted by email unless ?sort= (email, name, created_at) or USERS_DEFAULT_SORT says otherwise
+	~ curl localhost:8080/users\?sort=created_at
+	~ curl localhost:8080/users\?limit=10\&cursor=<next_cursor>
+
+	List Users whose name starts with a letter, sorted by name
+	~ curl localhost:8080/users/index/a
+
+	List Users created within a time range (either bound may be left out)
+	~ curl localhost:8080/users\?created_after=2024-01-01T00:00:00Z\&created_before=2024-02-01T00:00:00Z
+
+	Register users from a file at startup, e.g. [{"email":"lan@example.com", "name":"Lan"}]
+	~ go run . -seed users.json
+
+	Accept cleartext HTTP/2 next to HTTP/1.1
+	~ go run . -h2c
+	~ curl --http2-prior-knowledge localhost:8080/healthz
+
+	Serve HTTPS (TLS 1.2 minimum by default, 1.0 and 1.1 and insecure cipher suites are refused)
+	~ go run . -tls-cert cert.pem -tls-key key.pem -tls-min-version 1.3
+	~ curl -k https://localhost:8080/healthz
+
+	Keep users in a JSON file, rewritten after every change
+	~ go run . -store users.json
+	A ".gz" store is gzip-compressed on disk
+	~ go run . -store users.json.gz
+	In dev mode GET /debug/dump returns every user with its verification token, it is never registered otherwise
+	~ go run . -dev
+	~ curl localhost:8080/debug/dump
+	and GET /debug/deps lists the module versions built into the binary
+	~ curl localhost:8080/debug/deps
+	Also log request and response bodies, cut to 2KB, with any password or token field redacted
+	~ go run . -dev -log-bodies
+
+	Mirror every write to a replica file in the background, a failing mirror only logs
+	~ go run . -store users.json -replica replica.json
+
+	Serve on a Unix socket instead of TCP
+	~ go run . -addr unix:/tmp/users.sock
+	~ curl --unix-socket /tmp/users.sock localhost/user\?email=thanhdungfb@gmail.com
+
+	Any response can use camelCase keys instead of snake_case
+	~ curl localhost:8080/users\?case=camel
+	~ curl -H 'X-Key-Case: camel' localhost:8080/users
+
+	REGISTER_RATE (per second) and REGISTER_BURST cap registrations across all clients, extra ones get 429
+	~ REGISTER_RATE=5 REGISTER_BURST=10 go run .
+
+	JSON bodies nesting deeper than -max-body-depth (default 32) objects/arrays get 400
+	~ go run . -max-body-depth 8
+	JSON bodies with invalid UTF-8 get 400, and a charset other than utf-8 gets 415 (-require-utf8=false turns both off)
+	~ printf '{"email":"a@example.com","name":"\xff"}' | curl -XPOST -H 'Content-Type: application/json' --data-binary @- localhost:8080/register
+
+	Requests slower than SLOW_REQUEST_THRESHOLD (default 1s) also log a WARN line
+	~ SLOW_REQUEST_THRESHOLD=200ms go run .
+
+	TRUSTED_PROXIES lists proxy CIDRs whose X-Forwarded-For is believed for the client IP (lockout and access log)
+	~ TRUSTED_PROXIES=10.0.0.0/8,127.0.0.1 go run .
+
+	LOOKUP_LOCKOUT failed lookups of unknown users within LOOKUP_LOCKOUT_WINDOW (default 1m) lock the client IP out with 429 from every route that tells whether an email is registered (/user, /users/{email}, /users?email=, /users/batch-get, /register/check, /users/get-or-create and user.get on /rpc)
+	~ LOOKUP_LOCKOUT=10 LOOKUP_LOCKOUT_WINDOW=5m go run .
+
+	TIMESTAMP_FORMAT=unix writes created_at as seconds since the epoch instead of RFC 3339
+	~ TIMESTAMP_FORMAT=unix go run .
+
+	API_VERSIONS makes every route but the health checks require a matching Accept-Version header
+	~ API_VERSIONS=v1 go run .
+	~ curl -H 'Accept-Version: v1' localhost:8080/
+
+	REQUEST_TIMEOUT is the deadline for every route, ROUTE_TIMEOUTS overrides it per route pattern; late requests get 504
+	~ REQUEST_TIMEOUT=5s ROUTE_TIMEOUTS=/users=1s,/users/batch-get=3s go run .
+
+	DISABLED_ROUTES lists route patterns to leave out, they answer 404 (e.g. a read-only replica); /register and /user also turn off user.register and user.get on /rpc
+	~ DISABLED_ROUTES=/register,/users/bulk-delete,/users/merge,/rpc go run .
+
+	MAX_INFLIGHT caps concurrent requests, extra ones wait up to MAX_INFLIGHT_WAIT (default 0) then get 503
+	~ MAX_INFLIGHT=50 MAX_INFLIGHT_WAIT=100ms go run .
+
+	On SIGINT/SIGTERM in-flight requests get -shutdown-timeout (or SHUTDOWN_TIMEOUT, default 10s) to finish before being cut off
+	~ go run . -shutdown-timeout 30s
+
+	The /admin routes only exist when ADMIN_TOKEN is set, and need it as a bearer token
+	~ ADMIN_TOKEN=s3cret go run .
+
+	Reset a user to its default state, keeping only id and email
+	~ curl -H "Authorization: Bearer $ADMIN_TOKEN" -XPOST localhost:8080/admin/user/thanhdungfb@gmail.com/reset
+
+	Storage statistics (user count, memory estimate, and file size with -store)
+	~ curl -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8080/admin/storage/stats
+
+	The last emails looked up on /user and /users/{email}, oldest first (off unless RECENT_LOOKUPS sets how many to keep)
+	~ curl -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8080/admin/recent-lookups
+
+	Health check, and readiness of every subsystem (503 with the failing checks)
+	~ curl localhost:8080/healthz
+	~ curl localhost:8080/readyz
+
+	Switch maintenance mode on and off (every other route answers 503 meanwhile)
+	~ curl -H "Authorization: Bearer $ADMIN_TOKEN" -XPOST -d '{"enabled":true}' localhost:8080/admin/maintenance
+	~ curl -H "Authorization: Bearer $ADMIN_TOKEN" -XPOST -d '{"enabled":false}' localhost:8080/admin/maintenance
+
+	With ENVELOPE=true bodies are wrapped as {"data": ..., "error": null}
+
+	Trailing slashes are rewritten to the canonical path (TRAILING_SLASH=redirect answers 301 instead)
+	~ curl -XPOST -H 'Content-Type: application/json' -d '{"email":"thanhdungfb@gmail.com", "Name":"Alex Lee"}' localhost:8080/register/
+
 Test with Insomidia
 	1.
 	POST : localhost:8080/register
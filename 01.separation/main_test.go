@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alexlevn/go_simplest_restapi/idgen"
+)
+
+// newTestServer serves a fresh memory store with sequential user ids
+func newTestServer(t *testing.T, opts ...HTTPOption) (*JsonOverHTTP, *MemoryUserStorage) {
+	t.Helper()
+
+	storage := NewMemoUserStorage()
+	service := NewUserServiceImpl(storage, WithIDGenerator(idgen.NewSequentialIDGen(1)))
+	return NewJSONOverHTTP(service, opts...), storage
+}
+
+// do sends one request to h, header holds name/value pairs
+func do(h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// mustRegister registers email through POST /register
+func mustRegister(t *testing.T, h http.Handler, email, name string) {
+	t.Helper()
+
+	w := do(h, http.MethodPost, "/register", `{"email":"`+email+`", "name":"`+name+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register %s: got %d %s", email, w.Code, w.Body)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	joh, _ := newTestServer(t, WithWelcome("Hello"))
+
+	w := do(joh, http.MethodGet, "/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+
+	var index indexResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.Name != serviceName || index.Version != serviceVersion || index.Message != "Hello" {
+		t.Errorf("got %+v", index)
+	}
+	for _, e := range []string{"POST /register", "GET /user?email=", "GET /healthz", "GET /"} {
+		if !slices.Contains(index.Endpoints, e) {
+			t.Errorf("index is missing %q", e)
+		}
+	}
+
+	if w := do(joh, http.MethodGet, "/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /nope: got %d, want 404", w.Code)
+	}
+}
+
+func TestDisabledRoutes(t *testing.T) {
+	joh, storage := newTestServer(t, WithDisabledRoutes("/register", "/users/bulk-delete"))
+	storage.Save(context.Background(), &User{ID: "1", Email: "a@example.com", Name: "A"})
+
+	if w := do(joh, http.MethodPost, "/register", `{"email":"b@example.com", "name":"B"}`); w.Code != http.StatusNotFound {
+		t.Errorf("POST /register: got %d, want 404", w.Code)
+	}
+	if w := do(joh, http.MethodPost, "/users/bulk-delete", `{"emails":["a@example.com"]}`); w.Code != http.StatusNotFound {
+		t.Errorf("POST /users/bulk-delete: got %d, want 404", w.Code)
+	}
+	if w := do(joh, http.MethodGet, "/user?email=a@example.com", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /user: got %d, want 200", w.Code)
+	}
+
+	var index indexResponse
+	json.Unmarshal(do(joh, http.MethodGet, "/", "").Body.Bytes(), &index)
+	if slices.Contains(index.Endpoints, "POST /register") || !slices.Contains(index.Endpoints, "GET /user?email=") {
+		t.Errorf("index lists %v", index.Endpoints)
+	}
+}
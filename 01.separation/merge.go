@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+// ErrMergeSelf ...
+var ErrMergeSelf = errors.New("Cannot merge a user into itself")
+
+// Merge fills the empty fields of primary from secondary, then deletes
+// secondary. It may return an ErrUserNotFound or ErrMergeSelf error.
+func (us *UserServiceImpl) Merge(ctx context.Context, primary, secondary string) (u *User, err error) {
+	ctx, end := us.startSpan(ctx, "Merge")
+	defer func() { end(err) }()
+
+	if primary == secondary {
+		return nil, ErrMergeSelf
+	}
+
+	// one storage step, so no write to either user in between is lost
+	u, err = us.userStorage.Merge(ctx, primary, secondary, func(u, from *User) error {
+		mergeInto(u, from)
+		u.Version++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	us.record(ctx, "merge", primary)
+	us.record(ctx, "delete", secondary)
+	return u, nil
+}
+
+// mergeInto copies the non-empty fields of from that are empty in u. The name
+// is copied with its first/last parts or not at all, so they always match.
+// Keys in both metadata maps keep the value from u.
+func mergeInto(u, from *User) {
+	if u.Name == "" && u.FirstName == "" && u.LastName == "" {
+		u.Name, u.FirstName, u.LastName = from.Name, from.FirstName, from.LastName
+	}
+	if u.Phone == "" {
+		u.Phone = from.Phone
+	}
+
+	if len(from.Metadata) == 0 {
+		return
+	}
+
+	metadata := make(map[string]string, len(u.Metadata)+len(from.Metadata))
+	for k, v := range from.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range u.Metadata {
+		metadata[k] = v
+	}
+	u.Metadata = metadata
+}
+
+type mergeParams struct {
+	PrimaryEmail   string `json:"primary_email"`
+	SecondaryEmail string `json:"secondary_email"`
+}
+
+// MergeUsers handles POST /users/merge
+func (j *JsonOverHTTP) MergeUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		j.writeError(w, r, "MergeUsers requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if j.lockedOut(w, r) {
+		return
+	}
+
+	params := &mergeParams{}
+	err := jsonbody.Decode(w, r, params, j.bodyLimits)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	u, err := j.usrServ.Merge(r.Context(), params.PrimaryEmail, params.SecondaryEmail)
+
+	if errors.Is(err, ErrUserNotFound) {
+		j.failLookup(r)
+	}
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, u)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestMergeUsers(t *testing.T) {
+	joh, storage := newTestServer(t)
+	do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "name":"Alex", "metadata":{"team":"sales"}}`)
+	do(joh, http.MethodPost, "/register", `{"email":"b@example.com", "name":"Other", "phone":"+84901234567", "metadata":{"team":"ops","city":"Hue"}}`)
+
+	w := do(joh, http.MethodPost, "/users/merge", `{"primary_email":"a@example.com", "secondary_email":"b@example.com"}`)
+	var u User
+	if err := json.Unmarshal(w.Body.Bytes(), &u); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if u.Email != "a@example.com" || u.Name != "Alex" || u.Phone != "+84901234567" {
+		t.Errorf("got %+v", u)
+	}
+	if u.Metadata["team"] != "sales" || u.Metadata["city"] != "Hue" {
+		t.Errorf("metadata %v", u.Metadata)
+	}
+	if _, err := storage.Get(context.Background(), "b@example.com"); err == nil {
+		t.Error("the secondary user was not deleted")
+	}
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"primary_email":"a@example.com", "secondary_email":"b@example.com"}`, http.StatusNotFound},
+		{`{"primary_email":"nobody@example.com", "secondary_email":"a@example.com"}`, http.StatusNotFound},
+		{`{"primary_email":"a@example.com", "secondary_email":"a@example.com"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := do(joh, http.MethodPost, "/users/merge", tt.body); w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.body, w.Code, tt.status)
+		}
+	}
+
+	// a failed merge leaves the primary alone
+	if _, err := storage.Get(context.Background(), "a@example.com"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergeIntoNames(t *testing.T) {
+	u := &User{Phone: "+84901234567"}
+	mergeInto(u, &User{Name: "Alex Lee", FirstName: "Alex", LastName: "Lee"})
+	if u.Name != "Alex Lee" || u.FirstName != "Alex" || u.LastName != "Lee" {
+		t.Errorf("empty names: got %+v", u)
+	}
+
+	// a user with a name keeps all of it, even a part the other user has
+	u = &User{Name: "Minh", FirstName: "Minh"}
+	mergeInto(u, &User{Name: "Alex Lee", FirstName: "Alex", LastName: "Lee"})
+	if u.Name != "Minh" || u.FirstName != "Minh" || u.LastName != "" {
+		t.Errorf("mixed names: got %+v", u)
+	}
+}
+
+// TestMergeConcurrent merges two users into each other at once: exactly one
+// merge may win and exactly one user is left
+func TestMergeConcurrent(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		storage := NewMemoUserStorage()
+		us := NewUserServiceImpl(storage)
+		ctx := context.Background()
+		storage.Save(ctx, &User{ID: "1", Email: "a@example.com", Name: "A"})
+		storage.Save(ctx, &User{ID: "2", Email: "b@example.com", Name: "B"})
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for n, pair := range [][2]string{{"a@example.com", "b@example.com"}, {"b@example.com", "a@example.com"}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[n] = us.Merge(ctx, pair[0], pair[1])
+			}()
+		}
+		wg.Wait()
+
+		if (errs[0] == nil) == (errs[1] == nil) {
+			t.Fatalf("run %d: errors %v, want exactly one merge to win", i, errs)
+		}
+		if n := storage.store.Count(); n != 1 {
+			t.Fatalf("run %d: %d users left, want 1", i, n)
+		}
+	}
+}
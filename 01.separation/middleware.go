@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexlevn/go_simplest_restapi/idgen"
+)
+
+// SlashMode ...
+type SlashMode int
+
+const (
+	// SlashRewrite silently routes "/register/" as "/register"
+	SlashRewrite SlashMode = iota
+	// SlashRedirect answers "/register/" with a 301 to "/register"
+	SlashRedirect
+)
+
+// StripSlashes normalizes trailing-slash paths to their canonical form before routing
+func StripSlashes(next http.Handler, mode SlashMode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if len(path) <= 1 || !strings.HasSuffix(path, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		canonical := strings.TrimRight(path, "/")
+		if canonical == "" {
+			canonical = "/"
+		}
+
+		if mode == SlashRedirect {
+			u := *r.URL
+			u.Path = canonical
+			u.RawPath = ""
+			http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = canonical
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// CORSConfig ...
+type CORSConfig struct {
+	// AllowedOrigins may hold "*" to allow any origin on non-credentialed requests
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// MaxAge lets browsers cache a preflight response for this many seconds, 0 leaves it unset
+	MaxAge int
+	// AllowCredentials echoes the request Origin instead of "*", so only
+	// origins listed explicitly are allowed
+	AllowCredentials bool
+}
+
+func (c *CORSConfig) allowOrigin(origin string) string {
+	for _, o := range c.AllowedOrigins {
+		if o == origin {
+			return origin
+		}
+		if o == "*" && !c.AllowCredentials {
+			return "*"
+		}
+	}
+	return ""
+}
+
+// CORS answers preflight requests and adds CORS headers for allowed origins
+func CORS(next http.Handler, cfg CORSConfig) http.Handler {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	if methods == "" {
+		methods = "GET, POST, PUT, DELETE"
+	}
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	if headers == "" {
+		headers = "Content-Type"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := cfg.allowOrigin(origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if allowed == "" {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if cfg.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", methods)
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+		if cfg.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type ctxKey int
+
+const requestIDKey ctxKey = iota
+
+// RequestID tags each request with an X-Request-ID, reusing the one the client sent
+func RequestID(next http.Handler, ids idgen.IDGenerator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = ids.NewID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// RequestIDFrom returns the id set by RequestID, or "" outside of it
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// RecoverMiddleware turns a handler panic into a 500. It cancels the request
+// context so work started by the handler stops, and logs the request id so the
+// crash can be correlated with the access log.
+func RecoverMiddleware(next http.Handler, logger *log.Logger) http.Handler {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			cancel()
+			logger.Printf("panic: request_id=%s %s %s: %v\n%s", RequestIDFrom(ctx), r.Method, r.URL.Path, rec, debug.Stack())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Maintenance puts the service into maintenance mode without a redeploy.
+// It is flipped through POST /admin/maintenance.
+type Maintenance struct {
+	enabled atomic.Bool
+}
+
+// Enabled ...
+func (m *Maintenance) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// Set ...
+func (m *Maintenance) Set(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// maintenanceExempt lists the routes that keep working in maintenance mode
+func maintenanceExempt(path string) bool {
+	return path == "/healthz" || path == "/readyz" || path == "/admin" || strings.HasPrefix(path, "/admin/")
+}
+
+// Middleware answers 503 for every non-admin, non-health route while enabled
+func (m *Maintenance) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Enabled() || maintenanceExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{
+			"error": "Service is under maintenance, please try again later",
+		})
+	})
+}
+
+// statusRecorder remembers the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// AccessLog logs one line per request, plus a separate WARN line for requests
+// slower than slow. A zero slow disables the warning. The client IP is taken
+// from X-Forwarded-For only behind trustedProxies.
+func AccessLog(next http.Handler, logger *log.Logger, slow time.Duration, trustedProxies []*net.IPNet) http.Handler {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		d := time.Since(start)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		logger.Printf("INFO request_id=%s client_ip=%s %s %s %d %s", RequestIDFrom(r.Context()), ClientIP(r, trustedProxies), r.Method, r.URL.Path, rec.status, d)
+		if slow > 0 && d > slow {
+			logger.Printf("WARN slow request: request_id=%s %s %s took %s (threshold %s)", RequestIDFrom(r.Context()), r.Method, r.URL.Path, d, slow)
+		}
+	})
+}
+
+// ConcurrencyLimit caps the requests in flight at size. When full a request
+// waits up to wait for a slot, then gets a 503. A zero wait rejects at once.
+func ConcurrencyLimit(next http.Handler, size int, wait time.Duration) http.Handler {
+	sem := make(chan struct{}, size)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+		default:
+			if !acquireWithin(r.Context(), sem, wait) {
+				w.Header().Set("Retry-After", "1")
+				writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{
+					"error": "Server is busy, please try again later",
+				})
+				return
+			}
+		}
+		defer func() { <-sem }()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func acquireWithin(ctx context.Context, sem chan struct{}, wait time.Duration) bool {
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type versionError struct {
+	Error     string   `json:"error"`
+	Supported []string `json:"supported_versions"`
+}
+
+// RequireVersion makes clients send an Accept-Version header naming one of
+// supported. A missing header gets a 400, an unknown version a 406. Requests
+// for which exempt returns true, such as health checks, pass through.
+func RequireVersion(next http.Handler, supported []string, exempt func(path string) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt != nil && exempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		version := r.Header.Get("Accept-Version")
+		if version == "" {
+			writeJSON(w, r, http.StatusBadRequest, versionError{"Accept-Version header is required", supported})
+			return
+		}
+
+		for _, v := range supported {
+			if v == version {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		writeJSON(w, r, http.StatusNotAcceptable, versionError{"Accept-Version " + version + " is not supported", supported})
+	})
+}
+
+// healthPath reports whether path is a health check, which load balancers call without headers
+func healthPath(path string) bool {
+	return path == "/healthz" || path == "/readyz"
+}
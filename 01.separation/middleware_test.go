@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexlevn/go_simplest_restapi/idgen"
+)
+
+func TestStripSlashesRewrite(t *testing.T) {
+	joh, _ := newTestServer(t)
+	h := StripSlashes(joh, SlashRewrite)
+
+	for i, path := range []string{"/register", "/register/"} {
+		body := `{"email":"user` + string(rune('a'+i)) + `@example.com", "name":"User"}`
+		if w := do(h, http.MethodPost, path, body); w.Code != http.StatusCreated {
+			t.Errorf("POST %s: got %d %s, want 201", path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestStripSlashesRedirect(t *testing.T) {
+	joh, _ := newTestServer(t)
+	h := StripSlashes(joh, SlashRedirect)
+
+	w := do(h, http.MethodGet, "/user/?email=a@example.com", "")
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("got %d, want 301", w.Code)
+	}
+	if got := w.Header().Get("Location"); got != "/user?email=a@example.com" {
+		t.Errorf("Location = %q", got)
+	}
+
+	if w := do(h, http.MethodGet, "/", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /: got %d, want 200", w.Code)
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	h := CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), CORSConfig{
+		AllowedOrigins: []string{"*"},
+		MaxAge:         600,
+	})
+
+	w := do(h, http.MethodOptions, "/register", "", "Origin", "https://app.example.com", "Access-Control-Request-Method", "POST")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight: got %d, want 204", w.Code)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "*",
+		"Access-Control-Max-Age":           "600",
+		"Access-Control-Allow-Credentials": "",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	h := CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), CORSConfig{
+		AllowedOrigins:   []string{"*", "https://app.example.com"},
+		AllowCredentials: true,
+	})
+
+	w := do(h, http.MethodGet, "/user", "", "Origin", "https://app.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Allow-Origin = %q, want the echoed origin", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Allow-Credentials = %q, want true", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("Max-Age = %q on a non-preflight request", got)
+	}
+
+	// "*" does not cover credentialed requests, only listed origins do
+	w = do(h, http.MethodOptions, "/user", "", "Origin", "https://evil.example.com", "Access-Control-Request-Method", "GET")
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unlisted origin: got %d with Allow-Origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	h := RequestID(RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/boom" {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusOK)
+	}), log.New(&logs, "", 0)), idgen.NewSequentialIDGen(1))
+
+	w := do(h, http.MethodGet, "/boom", "", "X-Request-ID", "req-42")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got %d, want 500", w.Code)
+	}
+	if !strings.Contains(logs.String(), "request_id=req-42") || !strings.Contains(logs.String(), "boom") {
+		t.Errorf("log %q does not name the request id and panic", logs.String())
+	}
+
+	// the server keeps serving after a crash
+	if w := do(h, http.MethodGet, "/ok", ""); w.Code != http.StatusOK {
+		t.Errorf("next request: got %d, want 200", w.Code)
+	}
+}
+
+func TestAccessLogSlowRequest(t *testing.T) {
+	var logs bytes.Buffer
+	slowHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(30 * time.Millisecond)
+		}
+	})
+	h := AccessLog(slowHandler, log.New(&logs, "", 0), 10*time.Millisecond, nil)
+
+	do(h, http.MethodGet, "/fast", "")
+	if strings.Contains(logs.String(), "WARN") {
+		t.Errorf("fast request warned: %q", logs.String())
+	}
+
+	do(h, http.MethodGet, "/slow", "")
+	if !strings.Contains(logs.String(), "WARN slow request") || !strings.Contains(logs.String(), "/slow") {
+		t.Errorf("no slow request warning: %q", logs.String())
+	}
+
+	// a zero threshold turns the warning off
+	logs.Reset()
+	do(AccessLog(slowHandler, log.New(&logs, "", 0), 0, nil), http.MethodGet, "/slow", "")
+	if strings.Contains(logs.String(), "WARN") {
+		t.Errorf("warned with the threshold off: %q", logs.String())
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+
+	for _, wait := range []time.Duration{0, 50 * time.Millisecond} {
+		h := ConcurrencyLimit(slow, 1, wait)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			do(h, http.MethodGet, "/", "")
+		}()
+		<-entered
+
+		w := do(h, http.MethodGet, "/", "")
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("wait %s, full: got %d", wait, w.Code)
+		}
+
+		release <- struct{}{}
+		<-done
+	}
+
+	// a queued request gets the slot once it frees up
+	h := ConcurrencyLimit(slow, 1, 5*time.Second)
+	go do(h, http.MethodGet, "/", "")
+	<-entered
+	queued := make(chan int)
+	go func() { queued <- do(h, http.MethodGet, "/", "").Code }()
+	release <- struct{}{}
+	<-entered
+	release <- struct{}{}
+	if code := <-queued; code != http.StatusOK {
+		t.Errorf("queued request: got %d, want 200", code)
+	}
+}
+
+func TestRequireVersion(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := RequireVersion(ok, []string{"v1", "v2"}, healthPath)
+
+	tests := []struct {
+		path, version string
+		status        int
+	}{
+		{"/user", "v1", http.StatusOK},
+		{"/user", "v2", http.StatusOK},
+		{"/user", "", http.StatusBadRequest},
+		{"/user", "v3", http.StatusNotAcceptable},
+		{"/healthz", "", http.StatusOK},
+		{"/readyz", "v3", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := do(h, http.MethodGet, tt.path, "", "Accept-Version", tt.version)
+		if w.Code != tt.status {
+			t.Errorf("%s with %q: got %d, want %d", tt.path, tt.version, w.Code, tt.status)
+		}
+		if w.Code != http.StatusOK && !strings.Contains(w.Body.String(), `"supported_versions":["v1","v2"]`) {
+			t.Errorf("%s with %q: body %s does not list the versions", tt.path, tt.version, w.Body)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrNoMX is returned by Register when the email domain cannot receive mail
+var ErrNoMX = errors.New("Email domain has no mail server")
+
+// MXResolver is satisfied by *net.Resolver, tests can inject a fake
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// WithMXCheck makes Register look up the MX records of the email domain,
+// giving up after timeout. It needs network access so it is off by default.
+func WithMXCheck(resolver MXResolver, timeout time.Duration) ServiceOption {
+	return func(us *UserServiceImpl) {
+		us.mx = resolver
+		us.mxTimeout = timeout
+	}
+}
+
+// checkMX may return an ErrNoMX error, lookup failures other than "no such
+// host" are returned as is
+func (us *UserServiceImpl) checkMX(ctx context.Context, email string) error {
+	if us.mx == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, us.mxTimeout)
+	defer cancel()
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	records, err := us.mx.LookupMX(ctx, domain)
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return ErrNoMX
+	} else if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return ErrNoMX
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers from a map of domain to MX hosts, other domains do not exist
+type fakeResolver map[string][]string
+
+func (fr fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	hosts, ok := fr[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	if hosts == nil {
+		return nil, errors.New("lookup timed out")
+	}
+
+	records := []*net.MX{}
+	for _, h := range hosts {
+		records = append(records, &net.MX{Host: h})
+	}
+	return records, nil
+}
+
+func TestRegisterMXCheck(t *testing.T) {
+	resolver := fakeResolver{
+		"example.com": {"mx.example.com."},
+		"nomail.com":  {},
+		"flaky.com":   nil,
+	}
+	joh := NewJSONOverHTTP(NewUserServiceImpl(NewMemoUserStorage(), WithMXCheck(resolver, time.Second)))
+
+	mustRegister(t, joh, "a@example.com", "A")
+
+	for _, email := range []string{"a@nomail.com", "a@missing.com"} {
+		w := do(joh, http.MethodPost, "/register", `{"email":"`+email+`", "name":"A"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %s, want 400", email, w.Code, w.Body)
+		}
+	}
+
+	// a failing lookup is not the user's fault
+	w := do(joh, http.MethodPost, "/register", `{"email":"a@flaky.com", "name":"A"}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("lookup error: got %d, want 500", w.Code)
+	}
+
+	// without the option no lookup is made
+	mustRegister(t, NewJSONOverHTTP(NewUserServiceImpl(NewMemoUserStorage())), "a@missing.com", "A")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Sweeper is implemented by in-memory maps whose entries expire, such as the
+// lookup lockout counters
+type Sweeper interface {
+	// Sweep drops the entries expired at now and returns how many it dropped
+	Sweep(now time.Time) int
+}
+
+// Sweep ...
+func (l *Lockout) Sweep(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dropped := 0
+	for key := range l.failures {
+		if l.entry(key, now) == nil {
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// runReaper calls Sweep on every sweeper each interval until ctx is done. The
+// returned channel is closed once it has stopped.
+func runReaper(ctx context.Context, interval time.Duration, sweepers ...Sweeper) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for _, s := range sweepers {
+					s.Sweep(now)
+				}
+			}
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSweeper counts the sweeps it gets
+type countingSweeper struct {
+	sweeps atomic.Int32
+}
+
+func (cs *countingSweeper) Sweep(now time.Time) int {
+	cs.sweeps.Add(1)
+	return 0
+}
+
+func TestLockoutSweep(t *testing.T) {
+	l := NewLockout(3, time.Minute)
+	l.Fail("192.0.2.1")
+	l.Fail("192.0.2.2")
+
+	now := time.Now()
+	if n := l.Sweep(now); n != 0 {
+		t.Errorf("swept %d live entries", n)
+	}
+	if n := l.Sweep(now.Add(2 * time.Minute)); n != 2 || len(l.failures) != 0 {
+		t.Errorf("swept %d, %d left, want 2 and none", n, len(l.failures))
+	}
+}
+
+func TestRunReaper(t *testing.T) {
+	cs := &countingSweeper{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runReaper(ctx, 10*time.Millisecond, cs)
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reaper did not stop")
+	}
+
+	n := cs.sweeps.Load()
+	if n == 0 {
+		t.Error("no sweep ran")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if cs.sweeps.Load() != n {
+		t.Error("sweeps ran after the reaper stopped")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Lookup is one GetByEmail call
+type Lookup struct {
+	Email string    `json:"email"`
+	At    Timestamp `json:"at"`
+}
+
+// RecentLookups keeps the last few lookups in a fixed-size ring, so memory
+// stays bounded however many lookups are made
+type RecentLookups struct {
+	mu   sync.Mutex
+	ring []Lookup
+	next int
+	full bool
+}
+
+// NewRecentLookups remembers the last size lookups
+func NewRecentLookups(size int) *RecentLookups {
+	return &RecentLookups{ring: make([]Lookup, size)}
+}
+
+// Add records a lookup of email, overwriting the oldest one when full
+func (rl *RecentLookups) Add(email string, at time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if len(rl.ring) == 0 {
+		return
+	}
+
+	rl.ring[rl.next] = Lookup{Email: email, At: Timestamp{at}}
+	rl.next = (rl.next + 1) % len(rl.ring)
+	if rl.next == 0 {
+		rl.full = true
+	}
+}
+
+// List returns the lookups oldest first
+func (rl *RecentLookups) List() []Lookup {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if !rl.full {
+		return append([]Lookup{}, rl.ring[:rl.next]...)
+	}
+	return append(append([]Lookup{}, rl.ring[rl.next:]...), rl.ring[:rl.next]...)
+}
+
+// WithRecentLookups tracks the last size emails looked up on GET /user and
+// GET /users/{email}. It is off by default since the list holds personal data.
+func WithRecentLookups(size int) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.recent = NewRecentLookups(size)
+	}
+}
+
+// RecentLookups handles GET /admin/recent-lookups, oldest first
+func (j *JsonOverHTTP) RecentLookups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		j.writeError(w, r, "RecentLookups requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, j.recent.List())
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+	"golang.org/x/time/rate"
+)
+
+func TestCheckRegister(t *testing.T) {
+	joh, storage := newTestServer(t)
+	mustRegister(t, joh, "taken@example.com", "Taken")
+
+	tests := []struct {
+		email  string
+		status int
+		body   string
+	}{
+		{"free@example.com", http.StatusOK, `{"available":true}`},
+		{"taken@example.com", http.StatusOK, `{"available":false}`},
+		{"not-an-email", http.StatusBadRequest, ""},
+		{"", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := do(joh, http.MethodGet, "/register/check?email="+tt.email, "")
+		if w.Code != tt.status {
+			t.Errorf("%q: got %d, want %d", tt.email, w.Code, tt.status)
+		}
+		if tt.body != "" && strings.TrimSpace(w.Body.String()) != tt.body {
+			t.Errorf("%q: got %s, want %s", tt.email, w.Body, tt.body)
+		}
+	}
+
+	if n := storage.store.Count(); n != 1 {
+		t.Errorf("checking created users: %d stored, want 1", n)
+	}
+}
+
+func TestRegisterPhone(t *testing.T) {
+	joh, storage := newTestServer(t)
+
+	tests := []struct {
+		email  string
+		phone  string
+		status int
+	}{
+		{"valid@example.com", `"phone":"+84901234567",`, http.StatusCreated},
+		{"absent@example.com", "", http.StatusCreated},
+		{"local@example.com", `"phone":"0901234567",`, http.StatusBadRequest},
+		{"letters@example.com", `"phone":"+84abc",`, http.StatusBadRequest},
+		{"short@example.com", `"phone":"+1234",`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := do(joh, http.MethodPost, "/register", `{`+tt.phone+`"email":"`+tt.email+`", "name":"X"}`)
+		if w.Code != tt.status {
+			t.Errorf("%s: got %d %s, want %d", tt.email, w.Code, w.Body, tt.status)
+		}
+	}
+
+	u, ok := storage.store.Get("valid@example.com")
+	if !ok || u.Phone != "+84901234567" {
+		t.Errorf("phone not stored: %+v", u)
+	}
+}
+
+func TestRegisterDeeplyNested(t *testing.T) {
+	joh, _ := newTestServer(t)
+
+	body := `{"email":"a@example.com", "name":"A", "metadata":` + strings.Repeat("[", 50000) + strings.Repeat("]", 50000) + `}`
+	if w := do(joh, http.MethodPost, "/register", body); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d %s, want 400", w.Code, w.Body)
+	}
+}
+
+func TestRegisterBodyLimits(t *testing.T) {
+	limits := jsonbody.DefaultLimits
+	limits.MaxBytes = 64
+	joh, _ := newTestServer(t, WithBodyLimits(limits))
+
+	long := strings.Repeat("a", 64)
+	if w := do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "name":"`+long+`"}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("JSON: got %d, want 413", w.Code)
+	}
+	if w := do(joh, http.MethodPost, "/register", "email=a%40example.com&name="+long, "Content-Type", "application/x-www-form-urlencoded"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("form: got %d, want 413", w.Code)
+	}
+
+	// the limits belong to the server they are given to
+	other, _ := newTestServer(t)
+	if w := do(other, http.MethodPost, "/register", `{"email":"a@example.com", "name":"`+long+`"}`); w.Code != http.StatusCreated {
+		t.Errorf("default limits: got %d, want 201", w.Code)
+	}
+}
+
+func TestRegisterNames(t *testing.T) {
+	tests := []struct {
+		fields            string
+		name, first, last string
+	}{
+		{`"name":"Alex Lee"`, "Alex Lee", "Alex", "Lee"},
+		{`"name":"Alex"`, "Alex", "Alex", ""},
+		{`"name":"Nguyen Van An"`, "Nguyen Van An", "Nguyen", "Van An"},
+		{`"first_name":"Alex", "last_name":"Lee"`, "Alex Lee", "Alex", "Lee"},
+		{`"first_name":"Alex"`, "Alex", "Alex", ""},
+		{`"last_name":"Lee"`, "Lee", "", "Lee"},
+		{`"name":"Ignored", "first_name":"Alex", "last_name":"Lee"`, "Alex Lee", "Alex", "Lee"},
+	}
+
+	for _, tt := range tests {
+		joh, storage := newTestServer(t)
+		w := do(joh, http.MethodPost, "/register", `{"email":"a@example.com", `+tt.fields+`}`)
+		if w.Code != http.StatusCreated {
+			t.Errorf("%s: got %d %s", tt.fields, w.Code, w.Body)
+			continue
+		}
+
+		u, _ := storage.store.Get("a@example.com")
+		if u.Name != tt.name || u.FirstName != tt.first || u.LastName != tt.last {
+			t.Errorf("%s: got %q %q %q, want %q %q %q", tt.fields, u.Name, u.FirstName, u.LastName, tt.name, tt.first, tt.last)
+		}
+	}
+
+	joh, _ := newTestServer(t)
+	for _, fields := range []string{`"name":""`, `"first_name":" ", "last_name":""`, `"phone":"+84901234567"`} {
+		if w := do(joh, http.MethodPost, "/register", `{"email":"a@example.com", `+fields+`}`); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", fields, w.Code)
+		}
+	}
+}
+
+func TestRegisterLenientNames(t *testing.T) {
+	strict, _ := newTestServer(t)
+	if w := do(strict, http.MethodPost, "/register", `{"email":"hung@example.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("strict: got %d, want 400", w.Code)
+	}
+
+	lenient, storage := newTestServer(t, WithLenientNames())
+	if w := do(lenient, http.MethodPost, "/register", `{"email":"hung@example.com"}`); w.Code != http.StatusCreated {
+		t.Fatalf("lenient: got %d %s, want 201", w.Code, w.Body)
+	}
+	if u, _ := storage.store.Get("hung@example.com"); u.Name != "hung" {
+		t.Errorf("lenient: name %q, want the local part", u.Name)
+	}
+
+	// a given name is kept
+	do(lenient, http.MethodPost, "/register", `{"email":"lan@example.com", "name":"Lan Tran"}`)
+	if u, _ := storage.store.Get("lan@example.com"); u.Name != "Lan Tran" {
+		t.Errorf("lenient: name %q, want Lan Tran", u.Name)
+	}
+}
+
+func TestRegisterLimit(t *testing.T) {
+	// a burst of 2 that does not refill during the test
+	joh, _ := newTestServer(t, WithRegisterLimit(rate.Every(time.Hour), 2))
+
+	mustRegister(t, joh, "a@example.com", "A")
+	mustRegister(t, joh, "b@example.com", "B")
+
+	w := do(joh, http.MethodPost, "/register", `{"email":"c@example.com", "name":"C"}`)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("over the limit: got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// only /register is limited
+	if w := do(joh, http.MethodGet, "/user?email=a@example.com", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /user: got %d, want 200", w.Code)
+	}
+}
+
+func TestRegisterMetadata(t *testing.T) {
+	joh, _ := newTestServer(t)
+
+	w := do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "name":"A", "metadata":{"team":"sales"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	w = do(joh, http.MethodGet, "/user?email=a@example.com", "")
+	var u User
+	if err := json.Unmarshal(w.Body.Bytes(), &u); err != nil || u.Metadata["team"] != "sales" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	tooMany := map[string]string{}
+	for i := 0; i <= maxMetadataKeys; i++ {
+		tooMany[fmt.Sprint("k", i)] = "v"
+	}
+	long := strings.Repeat("x", maxMetadataBytes+1)
+	for name, metadata := range map[string]map[string]string{
+		"too many keys": tooMany,
+		"long key":      {long: "v"},
+		"long value":    {"k": long},
+		"empty key":     {"": "v"},
+	} {
+		body, _ := json.Marshal(map[string]interface{}{"email": "b@example.com", "name": "B", "metadata": metadata})
+		if w := do(joh, http.MethodPost, "/register", string(body)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestRegisterSanitizedNames(t *testing.T) {
+	const name = `Lan\u0007<script>alert(1)</script>`
+
+	tests := []struct {
+		escapeHTML bool
+		want       string
+	}{
+		{false, "Lan<script>alert(1)</script>"},
+		{true, "Lan&lt;script&gt;alert(1)&lt;/script&gt;"},
+	}
+	for _, tt := range tests {
+		storage := NewMemoUserStorage()
+		joh := NewJSONOverHTTP(NewUserServiceImpl(storage, WithSanitizedNames(tt.escapeHTML)))
+
+		mustRegister(t, joh, "a@example.com", name)
+		u, _ := storage.Get(context.Background(), "a@example.com")
+		if u.Name != tt.want {
+			t.Errorf("escapeHTML %v: stored %q, want %q", tt.escapeHTML, u.Name, tt.want)
+		}
+	}
+}
+
+func TestRegisterForm(t *testing.T) {
+	joh, storage := newTestServer(t)
+	const form = "application/x-www-form-urlencoded"
+
+	w := do(joh, http.MethodPost, "/register", "", "Content-Type", form)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty form: got %d, want 400", w.Code)
+	}
+
+	w = do(joh, http.MethodPost, "/register", "email=an%40example.com&name=An&metadata%5Bteam%5D=ops", "Content-Type", form)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+
+	u, err := storage.Get(context.Background(), "an@example.com")
+	if err != nil || u.Name != "An" || u.Metadata["team"] != "ops" {
+		t.Errorf("stored %+v, %v", u, err)
+	}
+
+	// the form still goes through validation
+	w = do(joh, http.MethodPost, "/register", "email=not-an-email&name=An", "Content-Type", form)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid email: got %d, want 400", w.Code)
+	}
+}
+
+func TestRegisterIfNoneMatch(t *testing.T) {
+	joh, _ := newTestServer(t)
+	const body = `{"email":"a@example.com", "name":"A"}`
+
+	if w := do(joh, http.MethodPost, "/register", body, "If-None-Match", "*"); w.Code != http.StatusCreated {
+		t.Fatalf("new user: got %d %s", w.Code, w.Body)
+	}
+	if w := do(joh, http.MethodPost, "/register", body, "If-None-Match", "*"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("existing user with If-None-Match: got %d, want 412", w.Code)
+	}
+	if w := do(joh, http.MethodPost, "/register", body); w.Code != http.StatusForbidden {
+		t.Errorf("existing user without it: got %d, want 403", w.Code)
+	}
+}
+
+func TestEmailLengthLimits(t *testing.T) {
+	// a local part and a domain adding up to n bytes
+	email := func(local, n int) string {
+		domain := strings.Repeat("d", n-local-len("@.com")) + ".com"
+		return strings.Repeat("l", local) + "@" + domain
+	}
+
+	tests := []struct {
+		email string
+		err   error
+	}{
+		{email(64, 100), nil},
+		{email(65, 100), ErrEmailLocalTooLong},
+		{email(10, 254), nil},
+		{email(10, 255), ErrEmailTooLong},
+	}
+	for _, tt := range tests {
+		if err := checkEmailLength(tt.email); err != tt.err {
+			t.Errorf("%d bytes: got %v, want %v", len(tt.email), err, tt.err)
+		}
+	}
+
+	joh, _ := newTestServer(t)
+	w := do(joh, http.MethodPost, "/register", `{"email":"`+email(65, 100)+`", "name":"A"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "local part") {
+		t.Errorf("got %d %s, want a 400 about the local part", w.Code, w.Body)
+	}
+}
+
+func TestRegisterInvalidUTF8(t *testing.T) {
+	joh, storage := newTestServer(t)
+
+	w := do(joh, http.MethodPost, "/register", "{\"email\":\"a@example.com\", \"name\":\"L\xe0n\"}")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "UTF-8") {
+		t.Errorf("got %d %s, want a 400 about UTF-8", w.Code, w.Body)
+	}
+	if _, err := storage.Get(context.Background(), "a@example.com"); err == nil {
+		t.Error("user was registered")
+	}
+
+	w = do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "name":"Lan"}`, "Content-Type", "application/json; charset=iso-8859-1")
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("latin-1 charset: got %d, want 415", w.Code)
+	}
+
+	if w := do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "name":"Lân"}`, "Content-Type", "application/json; charset=UTF-8"); w.Code != http.StatusCreated {
+		t.Errorf("valid UTF-8: got %d %s, want 201", w.Code, w.Body)
+	}
+}
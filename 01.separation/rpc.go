@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+// JSON-RPC 2.0 error codes, the -320xx ones are ours
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+
+	rpcEmailExist      = -32001
+	rpcUserNotFound    = -32002
+	rpcTooManyRequests = -32003
+	rpcNotVerified     = -32004
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// JSONRPCServer is a JSON-RPC 2.0 access layer over the same UserService as
+// JsonOverHTTP. It serves user.register and user.get.
+type JSONRPCServer struct {
+	usrServ UserService
+	joh     *JsonOverHTTP
+}
+
+// NewJSONRPCServer serves joh's UserService behind the same guards as the
+// REST routes: disabled routes, the registration limit, lenient mode, strict
+// verification and the lookup lockout
+func NewJSONRPCServer(joh *JsonOverHTTP) *JSONRPCServer {
+	return &JSONRPCServer{usrServ: joh.usrServ, joh: joh}
+}
+
+// ServeHTTP handles POST /rpc, with a single call or a batch
+func (rs *JSONRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the REST body checks apply to the whole body: size, UTF-8 and nesting
+	var data json.RawMessage
+	if err := jsonbody.Decode(w, r, &data, rs.joh.bodyLimits); err != nil {
+		msg := err.Error()
+		if errors.Is(err, jsonbody.ErrMalformed) {
+			msg = "Parse error"
+		}
+		writeJSON(w, r, http.StatusOK, rpcFailure(nil, rpcParseError, msg))
+		return
+	}
+
+	if data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			writeJSON(w, r, http.StatusOK, rpcFailure(nil, rpcParseError, "Parse error"))
+			return
+		}
+		if len(batch) == 0 {
+			writeJSON(w, r, http.StatusOK, rpcFailure(nil, rpcInvalidRequest, "Invalid request"))
+			return
+		}
+
+		responses := []*rpcResponse{}
+		for _, raw := range batch {
+			if resp := rs.call(r, raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSONAs(w, r, http.StatusOK, responses, rs.joh.timestampFormat)
+		return
+	}
+
+	resp := rs.call(r, data)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSONAs(w, r, http.StatusOK, resp, rs.joh.timestampFormat)
+}
+
+// call runs a single request, it returns nil for notifications
+func (rs *JSONRPCServer) call(r *http.Request, raw json.RawMessage) *rpcResponse {
+	req := &rpcRequest{}
+	if err := jsonbody.Unmarshal(raw, req); err != nil {
+		if !json.Valid(raw) {
+			return rpcFailure(nil, rpcParseError, "Parse error")
+		}
+		return rpcFailure(nil, rpcInvalidRequest, "Invalid request")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(req.ID, rpcInvalidRequest, "Invalid request")
+	}
+
+	result, rerr := rs.dispatch(r, req)
+	if req.ID == nil {
+		return nil
+	}
+	if rerr != nil {
+		return &rpcResponse{JSONRPC: "2.0", Error: rerr, ID: req.ID}
+	}
+	return &rpcResponse{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+func (rs *JSONRPCServer) dispatch(r *http.Request, req *rpcRequest) (interface{}, *rpcError) {
+	ctx := r.Context()
+	j := rs.joh
+
+	switch req.Method {
+	case "user.register":
+		if j.disabled["/register"] {
+			break
+		}
+		if j.registerLimiter != nil && !j.registerLimiter.Allow() {
+			return nil, &rpcError{rpcTooManyRequests, "Too many registrations, please try again later"}
+		}
+
+		params := &RegisterParams{}
+		if err := jsonbody.Unmarshal(req.Params, params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "Invalid params: " + err.Error()}
+		}
+		if j.lenient {
+			params.defaultName()
+		}
+		if err := j.validationRules.validate(params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		if err := rs.usrServ.Register(ctx, params); err != nil {
+			return nil, rpcServiceError(err)
+		}
+		u, err := rs.usrServ.GetByEmail(ctx, params.Email)
+		if err != nil {
+			return nil, rpcServiceError(err)
+		}
+		return u, nil
+
+	case "user.get":
+		if j.disabled["/user"] {
+			break
+		}
+		if j.lockout != nil {
+			if locked, _ := j.lockout.Locked(ClientIP(r, j.trustedProxies)); locked {
+				return nil, &rpcError{rpcTooManyRequests, "Too many failed lookups, please try again later"}
+			}
+		}
+
+		params := &struct {
+			Email string `json:"email"`
+		}{}
+		if err := jsonbody.Unmarshal(req.Params, params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "Invalid params: " + err.Error()}
+		}
+		if err := j.validateEmail(params.Email); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+
+		if j.recent != nil {
+			j.recent.Add(params.Email, time.Now())
+		}
+		u, err := rs.usrServ.GetByEmail(ctx, params.Email)
+		if errors.Is(err, ErrUserNotFound) {
+			j.failLookup(r)
+		}
+		if err != nil {
+			return nil, rpcServiceError(err)
+		}
+		if j.strictVerify && !u.Verified {
+			return nil, rpcServiceError(ErrNotVerified)
+		}
+		return u, nil
+	}
+
+	return nil, &rpcError{rpcMethodNotFound, "Method not found"}
+}
+
+// rpcServiceError maps UserService errors to JSON-RPC error objects
+func rpcServiceError(err error) *rpcError {
+	switch {
+	case errors.Is(err, ErrEmailExist):
+		return &rpcError{rpcEmailExist, err.Error()}
+	case errors.Is(err, ErrUserNotFound):
+		return &rpcError{rpcUserNotFound, err.Error()}
+	case errors.Is(err, ErrNotVerified):
+		return &rpcError{rpcNotVerified, err.Error()}
+	case errors.Is(err, ErrNoMX), errors.Is(err, ErrDisposableEmail):
+		return &rpcError{rpcInvalidParams, err.Error()}
+	}
+	return &rpcError{rpcInternalError, err.Error()}
+}
+
+func rpcFailure(id json.RawMessage, code int, msg string) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", Error: &rpcError{code, msg}, ID: id}
+}
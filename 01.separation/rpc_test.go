@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rpc posts body to a JSON-RPC server for joh and decodes a single response
+func rpc(t *testing.T, joh *JsonOverHTTP, body string) rpcResponse {
+	t.Helper()
+
+	w := do(NewJSONRPCServer(joh), http.MethodPost, "/rpc", body)
+	var resp rpcResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("%s: got %d %s", body, w.Code, w.Body)
+	}
+	return resp
+}
+
+func rpcCode(resp rpcResponse) int {
+	if resp.Error == nil {
+		return 0
+	}
+	return resp.Error.Code
+}
+
+func TestRPC(t *testing.T) {
+	joh, _ := newTestServer(t)
+
+	resp := rpc(t, joh, `{"jsonrpc":"2.0","method":"user.register","params":{"email":"a@example.com","name":"A"},"id":1}`)
+	if resp.Error != nil || string(resp.ID) != "1" {
+		t.Fatalf("register: %+v", resp)
+	}
+	resp = rpc(t, joh, `{"jsonrpc":"2.0","method":"user.get","params":{"email":"a@example.com"},"id":"x"}`)
+	if u, _ := resp.Result.(map[string]interface{}); u["name"] != "A" || string(resp.ID) != `"x"` {
+		t.Errorf("get: %+v", resp)
+	}
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"jsonrpc":"2.0","method":"user.register","params":{"email":"a@example.com","name":"A"},"id":1}`, rpcEmailExist},
+		{`{"jsonrpc":"2.0","method":"user.get","params":{"email":"none@example.com"},"id":1}`, rpcUserNotFound},
+		{`{"jsonrpc":"2.0","method":"user.get","params":{},"id":1}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","method":"user.register","params":{"email":"bad","name":"A"},"id":1}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","method":"user.delete","id":1}`, rpcMethodNotFound},
+		{`{"method":"user.get","id":1}`, rpcInvalidRequest},
+		{`{"jsonrpc":"2.0",`, rpcParseError},
+	}
+	for _, tt := range tests {
+		resp := rpc(t, joh, tt.body)
+		if rpcCode(resp) != tt.code || resp.Result != nil || resp.JSONRPC != "2.0" {
+			t.Errorf("%s: got %+v, want code %d", tt.body, resp, tt.code)
+		}
+	}
+
+	// notifications get no answer, batches one answer per call
+	w := do(NewJSONRPCServer(joh), http.MethodPost, "/rpc", `{"jsonrpc":"2.0","method":"user.get","params":{"email":"a@example.com"}}`)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("notification: got %d, want 204", w.Code)
+	}
+	w = do(NewJSONRPCServer(joh), http.MethodPost, "/rpc", `[
+		{"jsonrpc":"2.0","method":"user.get","params":{"email":"a@example.com"},"id":1},
+		{"jsonrpc":"2.0","method":"user.get","params":{"email":"a@example.com"}},
+		{"jsonrpc":"2.0","method":"nope","id":2}
+	]`)
+	var batch []rpcResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &batch); err != nil || len(batch) != 2 {
+		t.Fatalf("batch: got %d %s", w.Code, w.Body)
+	}
+	if batch[0].Error != nil || rpcCode(batch[1]) != rpcMethodNotFound {
+		t.Errorf("batch: %+v", batch)
+	}
+}
+
+func TestRPCGuards(t *testing.T) {
+	const (
+		register = `{"jsonrpc":"2.0","method":"user.register","params":{"email":"%s","name":"A"},"id":1}`
+		get      = `{"jsonrpc":"2.0","method":"user.get","params":{"email":"%s"},"id":1}`
+	)
+	call := func(joh *JsonOverHTTP, format, email string) int {
+		return rpcCode(rpc(t, joh, fmt.Sprintf(format, email)))
+	}
+
+	disabled, _ := newTestServer(t, WithDisabledRoutes("/register", "/user"))
+	if code := call(disabled, register, "a@example.com"); code != rpcMethodNotFound {
+		t.Errorf("disabled /register: got %d", code)
+	}
+	if code := call(disabled, get, "a@example.com"); code != rpcMethodNotFound {
+		t.Errorf("disabled /user: got %d", code)
+	}
+
+	limited, _ := newTestServer(t, WithRegisterLimit(rate.Every(time.Hour), 1))
+	call(limited, register, "a@example.com")
+	if code := call(limited, register, "b@example.com"); code != rpcTooManyRequests {
+		t.Errorf("over the registration limit: got %d", code)
+	}
+
+	strict, _ := newTestServer(t, WithStrictVerification())
+	call(strict, register, "a@example.com")
+	if code := call(strict, get, "a@example.com"); code != rpcNotVerified {
+		t.Errorf("unverified user: got %d", code)
+	}
+
+	locked, _ := newTestServer(t, WithLookupLockout(NewLockout(2, time.Minute)))
+	call(locked, register, "a@example.com")
+	call(locked, get, "none1@example.com")
+	call(locked, get, "none2@example.com")
+	if code := call(locked, get, "a@example.com"); code != rpcTooManyRequests {
+		t.Errorf("locked out: got %d", code)
+	}
+
+	lenient, _ := newTestServer(t, WithLenientNames())
+	resp := rpc(t, lenient, `{"jsonrpc":"2.0","method":"user.register","params":{"email":"lan@example.com"},"id":1}`)
+	if resp.Error != nil {
+		t.Errorf("lenient register without a name: %+v", resp.Error)
+	}
+}
+
+func TestRPCBodyChecks(t *testing.T) {
+	joh, _ := newTestServer(t, WithRecentLookups(10))
+	mustRegister(t, joh, "a@example.com", "A")
+
+	deep := `{"jsonrpc":"2.0","method":"user.get","params":{"email":"a@example.com","x":` + strings.Repeat("[", 100) + strings.Repeat("]", 100) + `},"id":1}`
+	tests := []struct {
+		body string
+		code int
+	}{
+		{deep, rpcParseError},
+		{`{"jsonrpc":"2.0","method":"user.get","params":{"email":"a@example.com","admin":true},"id":1}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","method":"user.register","params":{"email":"b@example.com","name":"B","role":"admin"},"id":1}`, rpcInvalidParams},
+		{`{"jsonrpc":"2.0","method":"user.get","params":{"email":"a@example.com"},"id":1,"extra":1}`, rpcInvalidRequest},
+		{`{"jsonrpc":"2.0","method":"user.get","params":{"email":"no-at-sign"},"id":1}`, rpcInvalidParams},
+	}
+	for _, tt := range tests {
+		if resp := rpc(t, joh, tt.body); rpcCode(resp) != tt.code {
+			t.Errorf("%.80s: got %+v, want code %d", tt.body, resp, tt.code)
+		}
+	}
+
+	rpc(t, joh, `{"jsonrpc":"2.0","method":"user.get","params":{"email":"a@example.com"},"id":1}`)
+	var emails []string
+	for _, l := range joh.recent.List() {
+		emails = append(emails, l.Email)
+	}
+	if !slices.Contains(emails, "a@example.com") {
+		t.Errorf("user.get was not recorded in the recent lookups: %v", emails)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// WithSanitizedNames strips control characters from names before they are
+// stored and, with escapeHTML, HTML-escapes them too so a name rendered
+// elsewhere cannot carry stored XSS
+func WithSanitizedNames(escapeHTML bool) ServiceOption {
+	return func(us *UserServiceImpl) {
+		us.sanitizeNames = true
+		us.escapeHTML = escapeHTML
+	}
+}
+
+func (us *UserServiceImpl) sanitize(name string) string {
+	if !us.sanitizeNames {
+		return name
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	if us.escapeHTML {
+		name = html.EscapeString(name)
+	}
+	return name
+}
+
+// sanitizedNames is RegisterParams.names run through sanitize
+func (us *UserServiceImpl) sanitizedNames(params *RegisterParams) (name, first, last string) {
+	name, first, last = params.names()
+	return us.sanitize(name), us.sanitize(first), us.sanitize(last)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+)
+
+// seedUsers registers the users listed in the JSON file at path, an array of
+// RegisterParams. Entries failing vr and already registered ones are logged
+// and skipped.
+func seedUsers(ctx context.Context, us UserService, vr ValidationRules, path string) (loaded, skipped int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var entries []*RegisterParams
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, 0, err
+	}
+
+	for i, params := range entries {
+		if params == nil {
+			log.Printf("seed: skipping entry %d: null", i)
+			skipped++
+			continue
+		}
+		if err := vr.validate(params); err != nil {
+			log.Printf("seed: skipping entry %d: %v", i, err)
+			skipped++
+			continue
+		}
+
+		err := us.Register(ctx, params)
+		if errors.Is(err, ErrEmailExist) {
+			log.Printf("seed: skipping entry %d: %s is already registered", i, params.Email)
+			skipped++
+			continue
+		} else if err != nil {
+			return loaded, skipped, err
+		}
+		loaded++
+	}
+
+	return loaded, skipped, nil
+}
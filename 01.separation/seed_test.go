@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSeedUsers(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	path := filepath.Join(t.TempDir(), "seed.json")
+	os.WriteFile(path, []byte(`[
+		{"email":"a@example.com", "name":"A"},
+		null,
+		{"email":"not-an-email", "name":"B"},
+		{"email":"a@example.com", "name":"A again"},
+		{"email":"c@example.com", "name":"C"}
+	]`), 0o600)
+
+	storage := NewMemoUserStorage()
+	loaded, skipped, err := seedUsers(context.Background(), NewUserServiceImpl(storage), ValidationRules{}, path)
+	if err != nil || loaded != 2 || skipped != 3 {
+		t.Fatalf("loaded %d, skipped %d, %v", loaded, skipped, err)
+	}
+	if u, err := storage.Get(context.Background(), "a@example.com"); err != nil || u.Name != "A" {
+		t.Errorf("a@example.com: %+v, %v", u, err)
+	}
+	for _, want := range []string{"entry 1: null", "entry 2:", "entry 3: a@example.com is already registered"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log is missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	if _, _, err := seedUsers(context.Background(), NewUserServiceImpl(storage), ValidationRules{}, filepath.Join(t.TempDir(), "none.json")); err == nil {
+		t.Error("a missing file should fail")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxHeaderBytes is well below net/http's 1 MB default, request headers
+// for this API are tiny and a smaller cap blunts header-bomb attacks
+const defaultMaxHeaderBytes = 64 << 10
+
+// newServer builds the http.Server, a non-positive maxHeaderBytes uses the default
+func newServer(handler http.Handler, maxHeaderBytes int) *http.Server {
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = defaultMaxHeaderBytes
+	}
+
+	return &http.Server{
+		Handler:        handler,
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+}
+
+// connTracker counts the connections that are in the middle of a request, it
+// is hooked up through http.Server.ConnState
+type connTracker struct {
+	mu     sync.Mutex
+	active map[net.Conn]struct{}
+}
+
+func trackConns(server *http.Server) *connTracker {
+	ct := &connTracker{active: map[net.Conn]struct{}{}}
+	server.ConnState = ct.observe
+	return ct
+}
+
+func (ct *connTracker) observe(c net.Conn, state http.ConnState) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if state == http.StateActive {
+		ct.active[c] = struct{}{}
+	} else {
+		delete(ct.active, c)
+	}
+}
+
+// Active ...
+func (ct *connTracker) Active() int {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return len(ct.active)
+}
+
+// drain shuts the server down gracefully, waiting at most timeout for
+// in-flight requests. Connections still busy after that are closed and counted.
+func drain(server *http.Server, conns *connTracker, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("shutdown: drain took longer than %s, abandoning %d in-flight connections", timeout, conns.Active())
+		err = server.Close()
+	}
+	if err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
+
+// listen opens a TCP listener, or a Unix socket when addr starts with "unix:".
+// The returned cleanup removes the socket file and is a no-op for TCP.
+func listen(addr string) (net.Listener, func(), error) {
+	path := strings.TrimPrefix(addr, "unix:")
+	if path == addr {
+		ln, err := net.Listen("tcp", addr)
+		return ln, func() {}, err
+	}
+
+	// a previous run that did not shut down cleanly leaves the socket file behind
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ln, func() { os.Remove(path) }, nil
+}
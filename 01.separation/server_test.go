@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.sock")
+	// a stale socket file from a previous run must not get in the way
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, cleanup, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joh, _ := newTestServer(t)
+	server := newServer(joh, 0)
+	go server.Serve(ln)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got %d, want 200", resp.StatusCode)
+	}
+
+	server.Close()
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+}
+
+func TestH2C(t *testing.T) {
+	joh, _ := newTestServer(t)
+	ts := httptest.NewServer(h2c.NewHandler(joh, &http2.Server{}))
+	defer ts.Close()
+
+	h2Client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+
+	// HTTP/1.1 clients keep working next to h2c ones
+	for _, tt := range []struct {
+		client *http.Client
+		major  int
+	}{{h2Client, 2}, {ts.Client(), 1}} {
+		resp, err := tt.client.Get(ts.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.ProtoMajor != tt.major {
+			t.Errorf("got %d over %s, want 200 over HTTP/%d", resp.StatusCode, resp.Proto, tt.major)
+		}
+	}
+}
+
+func TestNewServerMaxHeaderBytes(t *testing.T) {
+	for _, tt := range []struct{ configured, want int }{
+		{0, defaultMaxHeaderBytes},
+		{-1, defaultMaxHeaderBytes},
+		{1024, 1024},
+	} {
+		if got := newServer(http.NotFoundHandler(), tt.configured).MaxHeaderBytes; got != tt.want {
+			t.Errorf("newServer(%d): MaxHeaderBytes %d, want %d", tt.configured, got, tt.want)
+		}
+	}
+
+	joh, _ := newTestServer(t)
+	ts := httptest.NewUnstartedServer(joh)
+	ts.Config = newServer(joh, 1024)
+	ts.Start()
+	defer ts.Close()
+
+	// net/http allows some slack over the limit, so go well past it
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/healthz", nil)
+	req.Header.Set("X-Padding", strings.Repeat("x", 16<<10))
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("got %d, want 431", resp.StatusCode)
+	}
+}
+
+func TestDrainForcesClose(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(slow, 0)
+	conns := trackConns(server)
+	go server.Serve(ln)
+
+	reqErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		reqErr <- err
+	}()
+	<-entered
+
+	start := time.Now()
+	drain(server, conns, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("drain took %s", elapsed)
+	}
+
+	if !strings.Contains(buf.String(), "abandoning 1 in-flight connections") {
+		t.Errorf("log: %q", buf.String())
+	}
+	if err := <-reqErr; err == nil {
+		t.Error("the abandoned request succeeded")
+	}
+}
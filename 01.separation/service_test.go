@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingStorage counts Get calls and holds each one until release is closed
+type blockingStorage struct {
+	*MemoryUserStorage
+	calls   atomic.Int32
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockingStorage) Get(ctx context.Context, email string) (*User, error) {
+	if bs.calls.Add(1) == 1 {
+		close(bs.entered)
+	}
+	<-bs.release
+	return bs.MemoryUserStorage.Get(ctx, email)
+}
+
+func TestGetByEmailSingleflight(t *testing.T) {
+	storage := &blockingStorage{
+		MemoryUserStorage: NewMemoUserStorage(),
+		entered:           make(chan struct{}),
+		release:           make(chan struct{}),
+	}
+	storage.Save(context.Background(), &User{Email: "a@example.com", Name: "A", Metadata: map[string]string{"k": "v"}})
+	us := NewUserServiceImpl(storage)
+
+	const n = 10
+	users := make([]*User, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := us.GetByEmail(context.Background(), "a@example.com")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			users[i] = u
+		}()
+	}
+
+	<-storage.entered
+	// give the other lookups time to join the one in flight
+	time.Sleep(50 * time.Millisecond)
+	close(storage.release)
+	wg.Wait()
+
+	if calls := storage.calls.Load(); calls != 1 {
+		t.Errorf("%d backend calls for %d concurrent lookups, want 1", calls, n)
+	}
+
+	// callers share the lookup but not the result
+	users[0].Name = "changed"
+	users[0].Metadata["k"] = "changed"
+	for _, u := range users[1:] {
+		if u == users[0] || u.Name != "A" || u.Metadata["k"] != "v" {
+			t.Fatalf("a caller sees another caller's changes: %+v", u)
+		}
+	}
+}
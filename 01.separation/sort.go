@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/alexlevn/go_simplest_restapi/textfold"
+)
+
+// ErrUnknownSort is returned by List for a sort field it does not know
+var ErrUnknownSort = errors.New("Sort must be one of email, name, created_at")
+
+// sortableTime has a fixed width, so times compare correctly as strings
+const sortableTime = "2006-01-02T15:04:05.000000000Z07:00"
+
+// userSortKeys are the fields the user list can be sorted by. Users with the
+// same key are ordered by email, which is unique, so pages never overlap.
+var userSortKeys = map[string]func(*User) string{
+	"email":      func(u *User) string { return "" },
+	"name":       func(u *User) string { return textfold.Fold(u.Name) },
+	"created_at": func(u *User) string { return u.CreatedAt.UTC().Format(sortableTime) },
+}
+
+// sortedUser is a user with its sort key worked out once
+type sortedUser struct {
+	key  string
+	user *User
+}
+
+func (su sortedUser) after(key, email string) bool {
+	return su.key > key || su.key == key && su.user.Email > email
+}
+
+// sortUsers orders users, which are sorted by email, by the field named by
+// sortBy. It may return an ErrUnknownSort error.
+func sortUsers(users []*User, sortBy string) ([]sortedUser, error) {
+	keyOf, ok := userSortKeys[sortBy]
+	if !ok {
+		return nil, ErrUnknownSort
+	}
+
+	sorted := make([]sortedUser, len(users))
+	for i, u := range users {
+		sorted[i] = sortedUser{keyOf(u), u}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].key < sorted[j].key })
+	return sorted, nil
+}
+
+// listPosition is what UserPage.Next holds: just the email when sorting by
+// email, so older cursors keep working, or the sort key and the email
+func listPosition(su sortedUser) string {
+	if su.key == "" {
+		return su.user.Email
+	}
+	return su.key + "\x00" + su.user.Email
+}
+
+func parseListPosition(pos string) (key, email string) {
+	key, email, ok := strings.Cut(pos, "\x00")
+	if !ok {
+		return "", pos
+	}
+	return key, email
+}
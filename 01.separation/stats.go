@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"unsafe"
+)
+
+// ErrStatsUnsupported is returned by StorageStats when the storage does not implement StatsReporter
+var ErrStatsUnsupported = errors.New("Statistics are not supported by this storage")
+
+// StatsReporter is implemented by storers that can describe themselves for
+// GET /admin/storage/stats. The keys are backend-specific.
+type StatsReporter interface {
+	Stats() (map[string]interface{}, error)
+}
+
+// Stats reports the user count and a rough estimate of the memory they take
+func (ms *MemoryUserStorage) Stats() (map[string]interface{}, error) {
+	users := ms.store.List()
+
+	size := 0
+	for _, u := range users {
+		size += int(unsafe.Sizeof(*u)) + len(u.ID) + len(u.Email) + len(u.Name) + len(u.Phone) +
+			len(u.FirstName) + len(u.LastName) + len(u.VerificationToken)
+		for k, v := range u.Metadata {
+			size += len(k) + len(v)
+		}
+	}
+
+	return map[string]interface{}{
+		"backend":             "memory",
+		"users":               len(users),
+		"approx_memory_bytes": size,
+	}, nil
+}
+
+// Stats adds the file path and size to the memory statistics
+func (fs *FileUserStorage) Stats() (map[string]interface{}, error) {
+	stats, err := fs.MemoryUserStorage.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	stats["backend"] = "file"
+	stats["path"] = fs.path
+	stats["gzip"] = fs.gzip
+
+	info, err := os.Stat(fs.path)
+	if os.IsNotExist(err) {
+		stats["file_size_bytes"] = 0
+	} else if err != nil {
+		return nil, err
+	} else {
+		stats["file_size_bytes"] = info.Size()
+	}
+
+	return stats, nil
+}
+
+// StorageStats may return an ErrStatsUnsupported error
+func (us *UserServiceImpl) StorageStats(ctx context.Context) (stats map[string]interface{}, err error) {
+	_, end := us.startSpan(ctx, "StorageStats")
+	defer func() { end(err) }()
+
+	sr, ok := us.userStorage.(StatsReporter)
+	if !ok {
+		return nil, ErrStatsUnsupported
+	}
+	return sr.Stats()
+}
+
+// StorageStats handles GET /admin/storage/stats
+func (j *JsonOverHTTP) StorageStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		j.writeError(w, r, "StorageStats requires a get request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := j.usrServ.StorageStats(r.Context())
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, stats)
+}
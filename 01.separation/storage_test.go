@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexlevn/go_simplest_restapi/memstore"
+)
+
+func TestMemstoreUsers(t *testing.T) {
+	s := memstore.New(func(u *User) string { return u.Email })
+	if !s.Insert(&User{ID: "1", Email: "a@example.com"}) || s.Insert(&User{ID: "2", Email: "a@example.com"}) {
+		t.Fatal("Insert should refuse a taken email")
+	}
+
+	u, err := s.Update("a@example.com", func(u *User) (*User, error) {
+		moved := u.clone()
+		moved.Email = "b@example.com"
+		return moved, nil
+	})
+	if err != nil || u.ID != "1" {
+		t.Fatalf("Update: %+v, %v", u, err)
+	}
+	if _, ok := s.Get("a@example.com"); ok {
+		t.Error("the old email is still stored")
+	}
+
+	if u, ok := s.Delete("b@example.com"); !ok || u.ID != "1" || s.Count() != 0 {
+		t.Errorf("Delete: %+v, %v", u, ok)
+	}
+}
+
+func TestRekeyConcurrent(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoUserStorage()
+	for i := 0; i < 2; i++ {
+		storage.Save(ctx, &User{ID: fmt.Sprint(i), Email: fmt.Sprintf("old%d@example.com", i)})
+	}
+
+	// both users race for one new email, and many goroutines race to move user 0
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := storage.Rekey(ctx, fmt.Sprintf("old%d@example.com", i%2), "new@example.com", func(*User) error { return nil })
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	won := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case errors.Is(err, ErrEmailExist), errors.Is(err, ErrUserNotFound):
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d rekeys won, want exactly 1", won)
+	}
+
+	if n := storage.store.Count(); n != 2 {
+		t.Errorf("%d users stored, want 2", n)
+	}
+	if _, err := storage.Get(ctx, "new@example.com"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	joh, storage := newTestServer(t)
+	mustRegister(t, joh, "old@example.com", "Alex")
+	mustRegister(t, joh, "other@example.com", "Minh")
+	before, _ := storage.Get(context.Background(), "old@example.com")
+
+	w := do(joh, http.MethodPost, "/user/old@example.com/email", `{"new_email":"new@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+
+	if _, err := storage.Get(context.Background(), "old@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("old email still stored: %v", err)
+	}
+	after, err := storage.Get(context.Background(), "new@example.com")
+	if err != nil || after.ID != before.ID {
+		t.Errorf("got %+v, %v; want the user with id %s", after, err, before.ID)
+	}
+
+	if w := do(joh, http.MethodPost, "/user/new@example.com/email", `{"new_email":"other@example.com"}`); w.Code != http.StatusForbidden {
+		t.Errorf("taken email: got %d, want 403", w.Code)
+	}
+	if w := do(joh, http.MethodPost, "/user/gone@example.com/email", `{"new_email":"x@example.com"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: got %d, want 404", w.Code)
+	}
+}
+
+func TestChangeEmailNeedsVerifying(t *testing.T) {
+	joh, tokens := newVerifyServer(t)
+	mustRegister(t, joh, "old@example.com", "Alex")
+	if w := do(joh, http.MethodPost, "/verify", `{"email":"old@example.com", "token":"`+tokens["old@example.com"]+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("verify: got %d %s", w.Code, w.Body)
+	}
+	etag := do(joh, http.MethodGet, "/user?email=old@example.com", "").Header().Get("ETag")
+
+	w := do(joh, http.MethodPost, "/user/old@example.com/email", `{"new_email":"new@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	var u User
+	json.Unmarshal(w.Body.Bytes(), &u)
+	if u.Verified {
+		t.Error("the new email is verified without a token")
+	}
+	if tokens["new@example.com"] == "" || tokens["new@example.com"] == tokens["old@example.com"] {
+		t.Errorf("no new token was sent to the new email: %v", tokens)
+	}
+
+	w = do(joh, http.MethodPut, "/user?email=new@example.com", `{"name":"Alex Lee"}`, "If-Match", etag)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("ETag from before the change: got %d, want 412", w.Code)
+	}
+}
+
+func TestChangeEmailValidation(t *testing.T) {
+	bl, err := NewBlocklist(func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("throwaway.test\n")), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := fakeResolver{"example.com": {"mx.example.com."}, "throwaway.test": {"mx.throwaway.test."}}
+	joh := NewJSONOverHTTP(NewUserServiceImpl(NewMemoUserStorage(), WithBlocklist(bl), WithMXCheck(resolver, time.Second)),
+		WithValidationRules(ValidationRules{AllowedDomains: []string{"example.com", "throwaway.test", "nomail.com"}}))
+	mustRegister(t, joh, "a@example.com", "A")
+
+	tests := []struct {
+		newEmail string
+		want     int
+	}{
+		{"a@elsewhere.com", http.StatusUnprocessableEntity},
+		{"a@throwaway.test", http.StatusUnprocessableEntity},
+		{"a@nomail.com", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := do(joh, http.MethodPost, "/user/a@example.com/email", `{"new_email":"`+tt.newEmail+`"}`)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d %s, want %d", tt.newEmail, w.Code, w.Body, tt.want)
+		}
+	}
+
+	if w := do(joh, http.MethodGet, "/user?email=a@example.com", ""); w.Code != http.StatusOK {
+		t.Errorf("the user moved anyway: got %d", w.Code)
+	}
+}
+
+// TestListWhileSaving is meant for go test -race: encoding a listed page must
+// not read users that concurrent writes are changing
+func TestListWhileSaving(t *testing.T) {
+	joh, storage := newTestServer(t)
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		storage.Save(ctx, &User{Email: fmt.Sprintf("u%02d@example.com", i), Metadata: map[string]string{"n": "0"}})
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			email := fmt.Sprintf("u%02d@example.com", i%20)
+			storage.Update(ctx, email, func(u *User) error {
+				u.Name = fmt.Sprint(i)
+				u.Metadata["n"] = fmt.Sprint(i)
+				return nil
+			})
+			storage.Save(ctx, &User{Email: fmt.Sprintf("new%02d@example.com", i%20)})
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		if w := do(joh, http.MethodGet, "/users?limit=100", ""); w.Code != http.StatusOK {
+			t.Fatalf("got %d", w.Code)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestMemoryStorageCopies(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoUserStorage()
+
+	saved := &User{Email: "a@example.com", Name: "A", Metadata: map[string]string{"team": "sales"}}
+	storage.Save(ctx, saved)
+	saved.Name = "changed by the caller"
+
+	u, _ := storage.Get(ctx, "a@example.com")
+	u.Name = "changed"
+	u.Metadata["team"] = "changed"
+
+	list, _ := storage.List(ctx)
+	list[0].Name = "changed"
+	list[0].Metadata["team"] = "changed"
+
+	updated, _ := storage.Update(ctx, "a@example.com", func(u *User) error { return nil })
+	updated.Metadata["team"] = "changed"
+
+	got, _ := storage.Get(ctx, "a@example.com")
+	if got.Name != "A" || got.Metadata["team"] != "sales" {
+		t.Errorf("stored user changed: %+v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithTimeouts gives every route a deadline of def, or the one set for its
+// pattern in perRoute. A zero duration means no deadline.
+func WithTimeouts(def time.Duration, perRoute map[string]time.Duration) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.defaultTimeout = def
+		j.routeTimeouts = perRoute
+	}
+}
+
+// ParseRouteTimeouts reads "/register=2s,/users=500ms"
+func ParseRouteTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv == "" {
+			continue
+		}
+		pattern, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("route timeout %q must look like /path=duration", kv)
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		timeouts[pattern] = d
+	}
+	return timeouts, nil
+}
+
+// timeoutFor returns the deadline for the route registered under pattern
+func (j *JsonOverHTTP) timeoutFor(pattern string) time.Duration {
+	if d, ok := j.routeTimeouts[pattern]; ok {
+		return d
+	}
+	return j.defaultTimeout
+}
+
+// withTimeout runs h with a deadline of d, answering 504 when it is not done
+// in time. The response is buffered so a late handler cannot write over the 504.
+func (j *JsonOverHTTP) withTimeout(h http.HandlerFunc, d time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{header: http.Header{}}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			h(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			// re-panic here so RecoverMiddleware sees it
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			for k, v := range tw.header {
+				w.Header()[k] = v
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			w.WriteHeader(tw.status)
+			w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+
+			j.writeError(w, r, "Request took too long", http.StatusGatewayTimeout)
+		}
+	}
+}
+
+// timeoutWriter buffers a response until the handler is done
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.status == 0 {
+		tw.status = code
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
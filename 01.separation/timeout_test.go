@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// slowStorage takes delay over every Get, or gives up with the context
+type slowStorage struct {
+	UserStorer
+	delay time.Duration
+}
+
+func (ss slowStorage) Get(ctx context.Context, email string) (*User, error) {
+	select {
+	case <-time.After(ss.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return ss.UserStorer.Get(ctx, email)
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	timeouts, err := ParseRouteTimeouts("/user=20ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := slowStorage{UserStorer: NewMemoUserStorage(), delay: 100 * time.Millisecond}
+	joh := NewJSONOverHTTP(NewUserServiceImpl(storage), WithTimeouts(5*time.Second, timeouts))
+
+	start := time.Now()
+	w := do(joh, http.MethodGet, "/user?email=a@example.com", "")
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("short timeout: got %d, want 504", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("504 took %s", elapsed)
+	}
+
+	// the same lookup within the default deadline
+	if w := do(joh, http.MethodGet, "/register/check?email=a@example.com", ""); w.Code != http.StatusOK {
+		t.Errorf("default timeout: got %d %s, want 200", w.Code, w.Body)
+	}
+}
+
+func TestParseRouteTimeouts(t *testing.T) {
+	timeouts, err := ParseRouteTimeouts("/users=1s,/users/batch-get=250ms")
+	if err != nil || timeouts["/users"] != time.Second || timeouts["/users/batch-get"] != 250*time.Millisecond {
+		t.Errorf("got %v, %v", timeouts, err)
+	}
+	for _, bad := range []string{"/users", "/users=soon"} {
+		if _, err := ParseRouteTimeouts(bad); err == nil {
+			t.Errorf("%q: got no error", bad)
+		}
+	}
+}
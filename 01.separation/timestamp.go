@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// TimestampFormat ...
+type TimestampFormat int
+
+const (
+	// TimestampRFC3339 writes "2024-01-02T15:04:05Z"
+	TimestampRFC3339 TimestampFormat = iota
+	// TimestampUnix writes seconds since the epoch, 1704207845
+	TimestampUnix
+)
+
+// WithTimestampFormat changes how every Timestamp in a response is written,
+// RFC 3339 by default
+func WithTimestampFormat(f TimestampFormat) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.timestampFormat = f
+	}
+}
+
+// Timestamp is a time.Time a server writes in its TimestampFormat, see
+// writeJSONAs. encoding/json alone writes it as RFC 3339. Either format is
+// accepted when reading one back.
+type Timestamp struct {
+	time.Time
+}
+
+// UnmarshalJSON ...
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] != '"' && !bytes.Equal(data, []byte("null")) {
+		sec, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return err
+		}
+		t.Time = time.Unix(sec, 0).UTC()
+		return nil
+	}
+	return json.Unmarshal(data, &t.Time)
+}
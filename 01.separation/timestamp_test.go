@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTimestampFormats(t *testing.T) {
+	ts := Timestamp{time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)}
+	if data, err := json.Marshal(ts); err != nil || string(data) != `"2024-01-02T15:04:05Z"` {
+		t.Errorf("got %s, %v, want RFC 3339", data, err)
+	}
+
+	// either format reads back
+	for _, in := range []string{`"2024-01-02T15:04:05Z"`, `1704207845`} {
+		var back Timestamp
+		if err := json.Unmarshal([]byte(in), &back); err != nil || !back.Equal(ts.Time) {
+			t.Errorf("reading %s gave %v, %v", in, back, err)
+		}
+	}
+
+	// responses follow the server's format, camelCase or not
+	unix, _ := newTestServer(t, WithTimestampFormat(TimestampUnix))
+	rfc, _ := newTestServer(t)
+	for _, joh := range []*JsonOverHTTP{unix, rfc} {
+		mustRegister(t, joh, "a@example.com", "A")
+	}
+
+	tests := []struct {
+		joh    *JsonOverHTTP
+		target string
+		want   string
+	}{
+		{unix, "/user?email=a@example.com", `"created_at":\d+[,}]`},
+		{unix, "/user?email=a@example.com&case=camel", `"createdAt":\d+[,}]`},
+		{unix, "/users", `"created_at":\d+[,}]`},
+		{rfc, "/user?email=a@example.com", `"created_at":"\d{4}-\d\d-\d\dT`},
+	}
+	for _, tt := range tests {
+		w := do(tt.joh, http.MethodGet, tt.target, "")
+		if !regexp.MustCompile(tt.want).Match(w.Body.Bytes()) {
+			t.Errorf("%s: got %s, want %s", tt.target, w.Body, tt.want)
+		}
+	}
+}
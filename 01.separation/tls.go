@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// TLSSettings configures the HTTPS listener. The zero value means TLS 1.2 as
+// the minimum version and Go's default cipher suites.
+type TLSSettings struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.2" or "1.3", older versions are rejected
+	MinVersion string
+	// CipherSuites lists suite names as in tls.CipherSuiteName. They only
+	// apply to TLS 1.2, TLS 1.3 suites are not configurable.
+	CipherSuites []string
+}
+
+// Enabled ...
+func (ts *TLSSettings) Enabled() bool {
+	return ts.CertFile != "" || ts.KeyFile != ""
+}
+
+// Config builds the tls.Config, refusing insecure versions and cipher suites
+func (ts *TLSSettings) Config() (*tls.Config, error) {
+	if ts.CertFile == "" || ts.KeyFile == "" {
+		return nil, fmt.Errorf("tls: both a certificate and a key file are required")
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch ts.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("tls: unsupported minimum version %q, use 1.2 or 1.3", ts.MinVersion)
+	}
+
+	if len(ts.CipherSuites) == 0 {
+		return cfg, nil
+	}
+
+	secure := map[string]uint16{}
+	for _, cs := range tls.CipherSuites() {
+		secure[cs.Name] = cs.ID
+	}
+
+	for _, name := range ts.CipherSuites {
+		name = strings.TrimSpace(name)
+		id, ok := secure[name]
+		if !ok {
+			return nil, fmt.Errorf("tls: cipher suite %q is unknown or insecure", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+
+	return cfg, nil
+}
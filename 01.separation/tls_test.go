@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+)
+
+func TestTLSSettingsConfig(t *testing.T) {
+	files := TLSSettings{CertFile: "cert.pem", KeyFile: "key.pem"}
+
+	cfg, err := files.Config()
+	if err != nil || cfg.MinVersion != tls.VersionTLS12 || cfg.CipherSuites != nil {
+		t.Errorf("defaults: %+v, %v", cfg, err)
+	}
+
+	s := files
+	s.MinVersion = "1.3"
+	if cfg, err := s.Config(); err != nil || cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("1.3: %+v, %v", cfg, err)
+	}
+
+	s = files
+	s.CipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}
+	cfg, err = s.Config()
+	want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	if err != nil || !slices.Equal(cfg.CipherSuites, want) {
+		t.Errorf("cipher suites: %+v, %v", cfg, err)
+	}
+
+	for name, bad := range map[string]TLSSettings{
+		"no key":          {CertFile: "cert.pem"},
+		"TLS 1.0":         {CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.0"},
+		"insecure cipher": {CertFile: "cert.pem", KeyFile: "key.pem", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		"unknown cipher":  {CertFile: "cert.pem", KeyFile: "key.pem", CipherSuites: []string{"TLS_MADE_UP"}},
+	} {
+		if _, err := bad.Config(); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/alexlevn/go_simplest_restapi/01.separation"
+
+// WithTracer overrides the global tracer, which is a no-op until an exporter is configured
+func WithTracer(t trace.Tracer) ServiceOption {
+	return func(us *UserServiceImpl) {
+		us.tracer = t
+	}
+}
+
+// startSpan starts a child span of the request span, the returned func ends
+// it and records err on it
+func (us *UserServiceImpl) startSpan(ctx context.Context, method string) (context.Context, func(error)) {
+	ctx, span := us.tracer.Start(ctx, "UserService."+method)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// setupTracing installs a stdout exporter when OTEL_TRACES_EXPORTER=stdout.
+// Without an exporter the global tracer provider stays a no-op.
+func setupTracing() (func(context.Context) error, error) {
+	if os.Getenv("OTEL_TRACES_EXPORTER") != "stdout" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingSpanPerRequest(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+	us := NewUserServiceImpl(NewMemoUserStorage(), WithTracer(tp.Tracer(tracerName)))
+	h := otelhttp.NewHandler(NewJSONOverHTTP(us), serviceName, otelhttp.WithTracerProvider(tp))
+
+	mustRegister(t, h, "a@example.com", "A")
+	do(h, http.MethodGet, "/user?email=missing@example.com", "")
+
+	spans := exp.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	servers := 0
+	for _, s := range spans {
+		byName[s.Name] = s
+		if s.SpanKind == trace.SpanKindServer {
+			servers++
+		}
+	}
+
+	if servers != 2 {
+		t.Errorf("got %d request spans, want 2", servers)
+	}
+
+	register, ok := byName["UserService.Register"]
+	if !ok {
+		t.Fatal("no Register span")
+	}
+	if register.Parent.SpanID() != byName["POST /register"].SpanContext.SpanID() {
+		t.Error("Register span is not a child of the request span")
+	}
+
+	get, ok := byName["UserService.GetByEmail"]
+	if !ok {
+		t.Fatal("no GetByEmail span")
+	}
+	if get.Status.Code != codes.Error || len(get.Events) == 0 {
+		t.Errorf("the not found error is not recorded on the span: %+v", get.Status)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+// ErrVersionMismatch is returned when an update was based on a stale version of the user
+var ErrVersionMismatch = errors.New("User was modified since it was fetched")
+
+func etag(u *User) string {
+	return `"` + strconv.Itoa(u.Version) + `"`
+}
+
+// parseIfMatch returns the version in an If-Match header set from etag
+func parseIfMatch(h string) (int, bool) {
+	h = strings.TrimPrefix(strings.TrimSpace(h), "W/")
+	v, err := strconv.Atoi(strings.Trim(h, `"`))
+	return v, err == nil
+}
+
+// Update replaces the name, phone and metadata of a user, as long as version is still current
+func (us *UserServiceImpl) Update(ctx context.Context, email string, params *RegisterParams, version int) (u *User, err error) {
+	ctx, end := us.startSpan(ctx, "Update")
+	defer func() { end(err) }()
+
+	name, first, last := us.sanitizedNames(params)
+
+	u, err = us.userStorage.Update(ctx, email, func(u *User) error {
+		if u.Version != version {
+			return ErrVersionMismatch
+		}
+
+		u.Name = name
+		u.FirstName = first
+		u.LastName = last
+		u.Phone = params.Phone
+		u.Metadata = params.Metadata
+		u.Version++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	us.record(ctx, "update", email)
+	return u, nil
+}
+
+// UpdateUser handles PUT /user?email=, guarded by If-Match
+func (j *JsonOverHTTP) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	if j.lockedOut(w, r) {
+		return
+	}
+
+	email := r.FormValue("email")
+	err := j.validateEmail(email)
+
+	if err != nil {
+		j.writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		j.writeError(w, r, "UpdateUser requires an If-Match header", http.StatusPreconditionRequired)
+		return
+	}
+
+	version, ok := parseIfMatch(ifMatch)
+	if !ok {
+		j.writeError(w, r, ErrVersionMismatch.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	params := &RegisterParams{}
+	err = jsonbody.Decode(w, r, params, j.bodyLimits)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	params.Email = email
+	err = j.validationRules.validate(params)
+	if err != nil {
+		j.writeError(w, r, err.Error(), validationStatus(err))
+		return
+	}
+
+	u, err := j.usrServ.Update(r.Context(), email, params, version)
+
+	if errors.Is(err, ErrUserNotFound) {
+		j.failLookup(r)
+	}
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(u))
+	j.writeJSON(w, r, http.StatusOK, u)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUpdateUserIfMatch(t *testing.T) {
+	joh, storage := newTestServer(t)
+	mustRegister(t, joh, "a@example.com", "Alex")
+
+	etag := do(joh, http.MethodGet, "/user?email=a@example.com", "").Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag = %s", etag)
+	}
+
+	w := do(joh, http.MethodPut, "/user?email=a@example.com", `{"name":"Alex Lee"}`, "If-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("matching If-Match: got %d %s, ETag %s", w.Code, w.Body, w.Header().Get("ETag"))
+	}
+
+	// a second writer still holding the old ETag loses
+	w = do(joh, http.MethodPut, "/user?email=a@example.com", `{"name":"Someone Else"}`, "If-Match", etag)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: got %d, want 412", w.Code)
+	}
+	if u, _ := storage.store.Get("a@example.com"); u.Name != "Alex Lee" || u.Version != 2 {
+		t.Errorf("stored %+v", u)
+	}
+
+	if w := do(joh, http.MethodPut, "/user?email=a@example.com", `{"name":"X"}`); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("no If-Match: got %d, want 428", w.Code)
+	}
+	if w := do(joh, http.MethodPut, "/user?email=missing@example.com", `{"name":"X"}`, "If-Match", `"1"`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrDomainNotAllowed is returned for an email outside ValidationRules.AllowedDomains
+var ErrDomainNotAllowed = errors.New("Email domain is not allowed")
+
+// ValidationRules are the deployment-specific checks a server applies on top
+// of the fixed ones in RegisterParams.Validate. The zero value allows everything.
+type ValidationRules struct {
+	// MinNameLength and MaxNameLength count characters, 0 means no limit
+	MinNameLength int
+	MaxNameLength int
+	RequirePhone  bool
+	// AllowedDomains restricts signups to emails at these domains or their
+	// subdomains, empty allows any
+	AllowedDomains []string
+}
+
+// ValidationRulesFromEnv reads NAME_MIN_LENGTH, NAME_MAX_LENGTH, REQUIRE_PHONE
+// and the comma separated ALLOWED_DOMAINS
+func ValidationRulesFromEnv(getenv func(string) string) (ValidationRules, error) {
+	var vr ValidationRules
+	var err error
+
+	if v := getenv("NAME_MIN_LENGTH"); v != "" {
+		if vr.MinNameLength, err = strconv.Atoi(v); err != nil {
+			return vr, fmt.Errorf("NAME_MIN_LENGTH: %w", err)
+		}
+	}
+	if v := getenv("NAME_MAX_LENGTH"); v != "" {
+		if vr.MaxNameLength, err = strconv.Atoi(v); err != nil {
+			return vr, fmt.Errorf("NAME_MAX_LENGTH: %w", err)
+		}
+	}
+	vr.RequirePhone = getenv("REQUIRE_PHONE") == "true"
+
+	for _, d := range strings.Split(getenv("ALLOWED_DOMAINS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			vr.AllowedDomains = append(vr.AllowedDomains, strings.ToLower(d))
+		}
+	}
+
+	return vr, nil
+}
+
+// WithValidationRules applies vr to registrations and updates, and its
+// domain rules to email changes
+func WithValidationRules(vr ValidationRules) HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.validationRules = vr
+	}
+}
+
+// validate runs the fixed checks of RegisterParams.Validate, then the rules
+func (vr ValidationRules) validate(rp *RegisterParams) error {
+	if err := rp.Validate(); err != nil {
+		return err
+	}
+	return vr.check(rp)
+}
+
+// check applies the rules to rp, which has already passed the fixed checks
+func (vr ValidationRules) check(rp *RegisterParams) error {
+	name, _, _ := rp.names()
+	n := utf8.RuneCountInString(name)
+	if vr.MinNameLength > 0 && n < vr.MinNameLength {
+		return fmt.Errorf("Name must be at least %d characters", vr.MinNameLength)
+	}
+	if vr.MaxNameLength > 0 && n > vr.MaxNameLength {
+		return fmt.Errorf("Name cannot be longer than %d characters", vr.MaxNameLength)
+	}
+
+	if vr.RequirePhone && rp.Phone == "" {
+		return errors.New("Phone cannot be empty")
+	}
+
+	return vr.checkEmail(rp.Email)
+}
+
+// checkEmail applies the rules on the email alone, a user changing email
+// must pass them too
+func (vr ValidationRules) checkEmail(email string) error {
+	if len(vr.AllowedDomains) > 0 && !vr.domainAllowed(email) {
+		return fmt.Errorf("%w, use one of %s", ErrDomainNotAllowed, strings.Join(vr.AllowedDomains, ", "))
+	}
+	return nil
+}
+
+// domainAllowed matches the domain of email, or any of its parents, against
+// AllowedDomains: "mail.example.com" is allowed by "example.com" but
+// "badexample.com" is not
+func (vr ValidationRules) domainAllowed(email string) bool {
+	domain := strings.TrimSuffix(strings.ToLower(email[strings.LastIndexByte(email, '@')+1:]), ".")
+	for _, d := range vr.AllowedDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// validationStatus is the status for a Validate error: the one errorStatus
+// maps it to, such as 422 for ErrDomainNotAllowed, and 400 otherwise
+func validationStatus(err error) int {
+	if status := errorStatus(err); status != http.StatusInternalServerError {
+		return status
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidationRules(t *testing.T) {
+	vr := ValidationRules{MinNameLength: 2, MaxNameLength: 5, RequirePhone: true}
+
+	tests := []struct {
+		params RegisterParams
+		ok     bool
+	}{
+		{RegisterParams{Email: "a@example.com", Name: "Lan", Phone: "+84901234567"}, true},
+		{RegisterParams{Email: "a@example.com", Name: "Ánh", Phone: "+84901234567"}, true},
+		{RegisterParams{Email: "a@example.com", Name: "L", Phone: "+84901234567"}, false},
+		{RegisterParams{Email: "a@example.com", Name: "Nguyen", Phone: "+84901234567"}, false},
+		{RegisterParams{Email: "a@example.com", Name: "Lan"}, false},
+	}
+	for _, tt := range tests {
+		if err := vr.validate(&tt.params); (err == nil) != tt.ok {
+			t.Errorf("%+v: got %v", tt.params, err)
+		}
+	}
+
+	joh, _ := newTestServer(t, WithValidationRules(vr))
+	if w := do(joh, http.MethodPost, "/register", `{"email":"a@example.com", "name":"L", "phone":"+84901234567"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("short name: got %d, want 400", w.Code)
+	}
+
+	// the rules belong to the server they are given to
+	other, _ := newTestServer(t)
+	if w := do(other, http.MethodPost, "/register", `{"email":"a@example.com", "name":"L"}`); w.Code != http.StatusCreated {
+		t.Errorf("server without rules: got %d, want 201", w.Code)
+	}
+}
+
+func TestValidationRulesFromEnv(t *testing.T) {
+	env := map[string]string{
+		"NAME_MIN_LENGTH": "2",
+		"NAME_MAX_LENGTH": "40",
+		"REQUIRE_PHONE":   "true",
+		"ALLOWED_DOMAINS": "Example.com, corp.example.org,",
+	}
+	vr, err := ValidationRulesFromEnv(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vr.MinNameLength != 2 || vr.MaxNameLength != 40 || !vr.RequirePhone ||
+		len(vr.AllowedDomains) != 2 || vr.AllowedDomains[0] != "example.com" {
+		t.Errorf("got %+v", vr)
+	}
+
+	env["NAME_MAX_LENGTH"] = "lots"
+	if _, err := ValidationRulesFromEnv(func(k string) string { return env[k] }); err == nil {
+		t.Error("a bad NAME_MAX_LENGTH should fail")
+	}
+
+	// nothing set allows everything
+	vr, _ = ValidationRulesFromEnv(func(string) string { return "" })
+	if vr.MinNameLength != 0 || vr.MaxNameLength != 0 || vr.RequirePhone || vr.AllowedDomains != nil {
+		t.Errorf("empty environment: %+v", vr)
+	}
+}
+
+func TestAllowedDomains(t *testing.T) {
+	joh, _ := newTestServer(t, WithValidationRules(ValidationRules{AllowedDomains: []string{"example.com"}}))
+
+	tests := []struct {
+		email  string
+		status int
+	}{
+		{"a@example.com", http.StatusCreated},
+		{"b@EXAMPLE.com", http.StatusCreated},
+		{"c@mail.example.com", http.StatusCreated},
+		{"d@badexample.com", http.StatusUnprocessableEntity},
+		{"e@example.com.evil.org", http.StatusUnprocessableEntity},
+		{"f@gmail.com", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		w := do(joh, http.MethodPost, "/register", `{"email":"`+tt.email+`", "name":"A"}`)
+		if w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.email, w.Code, tt.status)
+		}
+		if tt.status != http.StatusCreated && !strings.Contains(w.Body.String(), "use one of example.com") {
+			t.Errorf("%s: message %s", tt.email, w.Body)
+		}
+	}
+
+	// an empty list allows any domain
+	joh, _ = newTestServer(t)
+	if w := do(joh, http.MethodPost, "/register", `{"email":"f@gmail.com", "name":"A"}`); w.Code != http.StatusCreated {
+		t.Errorf("no allow-list: got %d, want 201", w.Code)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+// ErrInvalidToken ...
+var ErrInvalidToken = errors.New("Invalid verification token")
+
+// ErrNotVerified is reported in strict mode for users who have not verified their email
+var ErrNotVerified = errors.New("User email is not verified")
+
+// VerificationHook delivers a freshly generated token to the user, e.g. by email
+type VerificationHook func(ctx context.Context, email, token string)
+
+// WithVerificationHook sets how tokens reach the user. Without a hook tokens
+// are never delivered, only the fact that one was issued is logged.
+func WithVerificationHook(h VerificationHook) ServiceOption {
+	return func(us *UserServiceImpl) {
+		us.sendToken = h
+	}
+}
+
+// undeliveredToken is the default hook, it keeps the token out of the logs
+func undeliveredToken(ctx context.Context, email, token string) {
+	log.Printf("verification token for %s issued but not delivered, no verification hook is set", email)
+}
+
+// logVerificationToken logs the token in plain text, for -dev only
+func logVerificationToken(ctx context.Context, email, token string) {
+	log.Printf("verification token for %s: %s", email, token)
+}
+
+// WebhookVerificationHook POSTs {"email": ..., "token": ...} to url, which
+// is expected to send the token on to the user
+func WebhookVerificationHook(url string, client *http.Client) VerificationHook {
+	return func(ctx context.Context, email, token string) {
+		body, err := json.Marshal(verifyParams{Email: email, Token: token})
+		if err != nil {
+			log.Printf("verification webhook: %v", err)
+			return
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("verification webhook: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("verification webhook for %s: %v", email, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("verification webhook for %s: %s", email, resp.Status)
+		}
+	}
+}
+
+func newVerificationToken() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Verify ...
+func (us *UserServiceImpl) Verify(ctx context.Context, email, token string) (u *User, err error) {
+	ctx, end := us.startSpan(ctx, "Verify")
+	defer func() { end(err) }()
+
+	u, err = us.userStorage.Update(ctx, email, func(u *User) error {
+		if u.Verified {
+			return nil
+		}
+
+		if u.VerificationToken == "" || subtle.ConstantTimeCompare([]byte(u.VerificationToken), []byte(token)) != 1 {
+			return ErrInvalidToken
+		}
+
+		u.Verified = true
+		u.VerificationToken = ""
+		u.Version++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	us.record(ctx, "verify", email)
+	return u, nil
+}
+
+// WithStrictVerification hides unverified users from GET /user
+func WithStrictVerification() HTTPOption {
+	return func(j *JsonOverHTTP) {
+		j.strictVerify = true
+	}
+}
+
+type verifyParams struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+// Verify handles POST /verify
+func (j *JsonOverHTTP) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		j.writeError(w, r, "Verify requires a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := &verifyParams{}
+	err := jsonbody.Decode(w, r, params, j.bodyLimits)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	err = j.validateEmail(params.Email)
+	if err != nil {
+		j.writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u, err := j.usrServ.Verify(r.Context(), params.Email, params.Token)
+
+	if err != nil {
+		j.writeJSONError(w, r, err)
+		return
+	}
+
+	j.writeJSON(w, r, http.StatusOK, u)
+}
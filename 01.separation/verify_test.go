@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newVerifyServer captures the tokens the service sends out
+func newVerifyServer(t *testing.T, opts ...HTTPOption) (*JsonOverHTTP, map[string]string) {
+	t.Helper()
+
+	tokens := map[string]string{}
+	hook := func(ctx context.Context, email, token string) { tokens[email] = token }
+	us := NewUserServiceImpl(NewMemoUserStorage(), WithVerificationHook(hook))
+	return NewJSONOverHTTP(us, opts...), tokens
+}
+
+func TestVerify(t *testing.T) {
+	joh, tokens := newVerifyServer(t, WithStrictVerification())
+	mustRegister(t, joh, "a@example.com", "A")
+
+	if tokens["a@example.com"] == "" {
+		t.Fatal("no token was sent")
+	}
+	if w := do(joh, http.MethodGet, "/user?email=a@example.com", ""); w.Code != http.StatusForbidden {
+		t.Errorf("unverified user in strict mode: got %d, want 403", w.Code)
+	}
+
+	w := do(joh, http.MethodPost, "/verify", `{"email":"a@example.com", "token":"`+tokens["a@example.com"]+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: got %d %s", w.Code, w.Body)
+	}
+
+	w = do(joh, http.MethodGet, "/user?email=a@example.com", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("verified user: got %d", w.Code)
+	}
+	var u User
+	json.Unmarshal(w.Body.Bytes(), &u)
+	if !u.Verified {
+		t.Error("user is not verified")
+	}
+	if strings.Contains(w.Body.String(), tokens["a@example.com"]) {
+		t.Error("the token is sent back to clients")
+	}
+}
+
+func TestVerifyWrongToken(t *testing.T) {
+	joh, _ := newVerifyServer(t)
+	mustRegister(t, joh, "a@example.com", "A")
+
+	if w := do(joh, http.MethodPost, "/verify", `{"email":"a@example.com", "token":"wrong"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("wrong token: got %d, want 400", w.Code)
+	}
+	if w := do(joh, http.MethodPost, "/verify", `{"email":"missing@example.com", "token":"x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: got %d, want 404", w.Code)
+	}
+
+	w := do(joh, http.MethodGet, "/user?email=a@example.com", "")
+	var u User
+	json.Unmarshal(w.Body.Bytes(), &u)
+	if u.Verified {
+		t.Error("a wrong token verified the user")
+	}
+}
+
+func TestUndeliveredTokenIsNotLogged(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	undeliveredToken(context.Background(), "a@example.com", "s3cr3t-token")
+	if strings.Contains(logs.String(), "s3cr3t-token") {
+		t.Errorf("token logged: %q", logs.String())
+	}
+}
+
+func TestWebhookVerificationHook(t *testing.T) {
+	var got verifyParams
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	hook := WebhookVerificationHook(srv.URL, srv.Client())
+	hook(context.Background(), "a@example.com", "tok")
+
+	if got.Email != "a@example.com" || got.Token != "tok" {
+		t.Errorf("webhook got %+v", got)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminToken guards the /admin routes, set with ADMIN_TOKEN. Without it the
+// admin routes are not registered at all.
+var adminToken string
+
+// requireAdmin answers 401 unless the request carries
+// "Authorization: Bearer <adminToken>"
+func requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Admin token is missing or wrong", http.StatusUnauthorized)
+			return
+		}
+		h(w, req)
+	}
+}
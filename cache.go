@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// cacheMaxAge is how many seconds proxies may cache the people reads, set
+// with CACHE_MAX_AGE. At 0 they must revalidate every time.
+var cacheMaxAge int
+
+// cacheable lets clients and proxies reuse the response of a read for cacheMaxAge
+func cacheable(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if cacheMaxAge > 0 {
+			w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(cacheMaxAge))
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		h(w, req)
+	}
+}
+
+// noStore keeps the response of a mutation out of every cache
+func noStore(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		h(w, req)
+	}
+}
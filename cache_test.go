@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCacheControl(t *testing.T) {
+	defer func(saved int) { cacheMaxAge = saved }(cacheMaxAge)
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		maxAge int
+		want   string
+	}{
+		{http.MethodGet, "/people", "", 60, "public, max-age=60"},
+		{http.MethodGet, "/people/1", "", 60, "public, max-age=60"},
+		{http.MethodGet, "/people", "", 0, "no-cache"},
+		{http.MethodGet, "/people/1", "", 0, "no-cache"},
+		{http.MethodPost, "/people/add", `{"firstname":"Hoa"}`, 60, "no-store"},
+		{http.MethodPatch, "/people/1", `{"firstname":"Alexander"}`, 60, "no-store"},
+		{http.MethodPut, "/people/1/address", `{"city":"Hue","state":"Phu Hoi"}`, 60, "no-store"},
+		{http.MethodDelete, "/people/1", "", 60, "no-store"},
+	}
+	for _, tt := range tests {
+		withPeople(t, samplePeople...)
+		cacheMaxAge = tt.maxAge
+
+		w := serve(tt.method, tt.target, tt.body)
+		if w.Code >= 300 {
+			t.Fatalf("%s %s: got %d %s", tt.method, tt.target, w.Code, w.Body)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s %s with max age %d: Cache-Control %q, want %q", tt.method, tt.target, tt.maxAge, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// personEvent is sent to GET /people/events subscribers
+type personEvent struct {
+	Type   string `json:"type"`
+	Person Person `json:"person"`
+	// OldID is the id a "renumbered" person had before
+	OldID string `json:"old_id,omitempty"`
+}
+
+// peopleBroker fans person events out to every subscriber
+type peopleBroker struct {
+	mu   sync.Mutex
+	subs map[chan personEvent]struct{}
+}
+
+var peopleEvents = &peopleBroker{subs: map[chan personEvent]struct{}{}}
+
+func (b *peopleBroker) subscribe() chan personEvent {
+	ch := make(chan personEvent, 16)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[ch] = struct{}{}
+	return ch
+}
+
+func (b *peopleBroker) unsubscribe(ch chan personEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, ch)
+}
+
+// publish never blocks, a subscriber that falls behind misses events
+func (b *peopleBroker) publish(eventType string, p Person) {
+	b.send(personEvent{Type: eventType, Person: p})
+}
+
+// publishRenumbered tells subscribers p was known as oldID until now
+func (b *peopleBroker) publishRenumbered(p Person, oldID string) {
+	b.send(personEvent{Type: "renumbered", Person: p, OldID: oldID})
+}
+
+func (b *peopleBroker) send(ev personEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func peopleEventsEndpoint(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := peopleEvents.subscribe()
+	defer peopleEvents.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case ev := <-ch:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+func subscriberCount() int {
+	peopleEvents.mu.Lock()
+	defer peopleEvents.mu.Unlock()
+	return len(peopleEvents.subs)
+}
+
+func TestPeopleEvents(t *testing.T) {
+	withPeople(t)
+	ts := httptest.NewServer(newRouter(false, jsonbody.DefaultLimits))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/people/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type %q", ct)
+	}
+
+	// the headers are only flushed once the subscription is in place
+	post, err := http.Post(ts.URL+"/people/add", "application/json", strings.NewReader(`{"firstname":"Lan","lastname":"Tran"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+
+	lines := bufio.NewScanner(resp.Body)
+	var event, data string
+	for data == "" && lines.Scan() {
+		line := lines.Text()
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = v
+		} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+
+	var ev personEvent
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatalf("data %q: %v", data, err)
+	}
+	if event != "created" || ev.Type != "created" || ev.Person.Firstname != "Lan" || ev.Person.ID == "" {
+		t.Errorf("got event %q %+v", event, ev)
+	}
+
+	// a client that goes away is unsubscribed
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for subscriberCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber still registered after disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+// Package idgen generates identifiers for people and users
+package idgen
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// IDGenerator ...
+type IDGenerator interface {
+	NewID() string
+}
+
+// SequentialIDGen hands out "1", "2", "3"... and is handy for deterministic tests
+type SequentialIDGen struct {
+	next atomic.Int64
+}
+
+// NewSequentialIDGen returns a generator whose first ID is start
+func NewSequentialIDGen(start int64) *SequentialIDGen {
+	g := &SequentialIDGen{}
+	g.next.Store(start)
+	return g
+}
+
+// NewID ...
+func (g *SequentialIDGen) NewID() string {
+	return strconv.FormatInt(g.next.Add(1)-1, 10)
+}
+
+// Resetter is implemented by generators that can be told where to continue
+type Resetter interface {
+	Reset(next int64)
+}
+
+// Reset makes next the ID handed out next
+func (g *SequentialIDGen) Reset(next int64) {
+	g.next.Store(next)
+}
+
+// UUIDIDGen hands out random (version 4) UUIDs
+type UUIDIDGen struct{}
+
+// NewID ...
+func (UUIDIDGen) NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
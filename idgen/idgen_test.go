@@ -0,0 +1,63 @@
+package idgen
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSequentialIDGen(t *testing.T) {
+	g := NewSequentialIDGen(7)
+	for _, want := range []string{"7", "8", "9"} {
+		if got := g.NewID(); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestSequentialIDGenReset(t *testing.T) {
+	g := NewSequentialIDGen(7)
+	g.NewID()
+	g.Reset(3)
+	if got := g.NewID(); got != "3" {
+		t.Errorf("after Reset(3): got %s", got)
+	}
+}
+
+func TestDistinctIDs(t *testing.T) {
+	gens := map[string]IDGenerator{
+		"sequential": NewSequentialIDGen(1),
+		"uuid":       UUIDIDGen{},
+	}
+
+	for name, g := range gens {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			seen := map[string]bool{}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						id := g.NewID()
+						mu.Lock()
+						if seen[id] {
+							t.Errorf("duplicate id %s", id)
+						}
+						seen[id] = true
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestUUIDFormat(t *testing.T) {
+	id := UUIDIDGen{}.NewID()
+	if len(id) != 36 || id[14] != '4' {
+		t.Errorf("%s is not a version 4 UUID", id)
+	}
+}
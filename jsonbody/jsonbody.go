@@ -0,0 +1,187 @@
+// Package jsonbody decodes JSON request bodies for both the people and the user APIs
+package jsonbody
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrEmpty ...
+	ErrEmpty = errors.New("Request body is empty")
+	// ErrTooLarge ...
+	ErrTooLarge = errors.New("Request body is too large")
+	// ErrTooDeep ...
+	ErrTooDeep = errors.New("Request body is nested too deeply")
+	// ErrUnknownField ...
+	ErrUnknownField = errors.New("Request body has an unknown field")
+	// ErrMalformed ...
+	ErrMalformed = errors.New("Unable to read your request")
+	// ErrUnsupportedMediaType ...
+	ErrUnsupportedMediaType = errors.New("Content-Type must be application/json")
+	// ErrInvalidUTF8 ...
+	ErrInvalidUTF8 = errors.New("Request body must be valid UTF-8")
+	// ErrUnsupportedCharset ...
+	ErrUnsupportedCharset = errors.New("Request body charset must be utf-8")
+)
+
+// Limits ...
+type Limits struct {
+	// MaxBytes caps how much of a request body is read
+	MaxBytes int64
+	// MaxDepth caps how deeply objects and arrays may nest, 0 disables the check
+	MaxDepth int
+	// RequireJSON rejects bodies whose Content-Type is set to anything but
+	// JSON. It is off by default because curl -d sends a form content type.
+	RequireJSON bool
+	// RequireUTF8 rejects bodies that are not valid UTF-8, or that declare
+	// another charset, instead of letting encoding/json replace the bad bytes
+	RequireUTF8 bool
+}
+
+// DefaultLimits ...
+var DefaultLimits = Limits{
+	MaxBytes:    1 << 20,
+	MaxDepth:    32,
+	RequireUTF8: true,
+}
+
+// Error is what Decode returns, Status is the HTTP status to answer with
+type Error struct {
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap lets errors.Is match the Err* sentinels
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status for an error returned by Decode, 400 for any other error
+func Status(err error) int {
+	var de *Error
+	if errors.As(err, &de) {
+		return de.Status
+	}
+	return http.StatusBadRequest
+}
+
+// Decode reads a single JSON value from the request body into dst. Unknown
+// fields, trailing data and empty bodies are rejected.
+func Decode[T any](w http.ResponseWriter, r *http.Request, dst *T, limits Limits) error {
+	if limits.RequireJSON && !isJSON(r.Header.Get("Content-Type")) {
+		return &Error{http.StatusUnsupportedMediaType, ErrUnsupportedMediaType}
+	}
+	if limits.RequireUTF8 && !isUTF8Charset(r.Header.Get("Content-Type")) {
+		return &Error{http.StatusUnsupportedMediaType, ErrUnsupportedCharset}
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limits.MaxBytes))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return &Error{http.StatusRequestEntityTooLarge, ErrTooLarge}
+		}
+		return &Error{http.StatusBadRequest, ErrMalformed}
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &Error{http.StatusBadRequest, ErrEmpty}
+	}
+
+	if limits.RequireUTF8 && !utf8.Valid(data) {
+		return &Error{http.StatusBadRequest, ErrInvalidUTF8}
+	}
+
+	if limits.MaxDepth > 0 {
+		if err := CheckDepth(bytes.NewReader(data), limits.MaxDepth); err != nil {
+			return &Error{http.StatusBadRequest, err}
+		}
+	}
+
+	return Unmarshal(data, dst)
+}
+
+// Unmarshal decodes data into dst as strictly as Decode does a body: unknown
+// fields and trailing data are rejected. It is meant for JSON nested in a
+// body that Decode already checked, such as the calls in a JSON-RPC batch.
+func Unmarshal[T any](data []byte, dst *T) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return &Error{http.StatusBadRequest, fmt.Errorf("%w %s", ErrUnknownField, field)}
+		}
+		return &Error{http.StatusBadRequest, ErrMalformed}
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return &Error{http.StatusBadRequest, ErrMalformed}
+	}
+
+	return nil
+}
+
+// isJSON accepts a missing Content-Type, application/json and any +json type
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// isUTF8Charset accepts a Content-Type without a charset, or with utf-8
+func isUTF8Charset(contentType string) bool {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// a missing or unparsable Content-Type is left to RequireJSON
+		return true
+	}
+
+	charset, ok := params["charset"]
+	return !ok || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "utf8")
+}
+
+// CheckDepth walks the token stream of r and stops with ErrTooDeep as soon as
+// objects and arrays nest deeper than max, without building any values.
+// Invalid JSON gives ErrMalformed.
+func CheckDepth(r io.Reader, max int) error {
+	dec := json.NewDecoder(r)
+	depth := 0
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && depth == 0 {
+			return nil
+		} else if err != nil {
+			return ErrMalformed
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > max {
+				return ErrTooDeep
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package jsonbody
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decode(body string, limits Limits, header ...string) error {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	var dst map[string]interface{}
+	return Decode(httptest.NewRecorder(), r, &dst, limits)
+}
+
+func TestDecodePathologicalNesting(t *testing.T) {
+	body := `{"a":` + strings.Repeat("[", 100000) + strings.Repeat("]", 100000) + `}`
+
+	err := decode(body, DefaultLimits)
+	if !errors.Is(err, ErrTooDeep) || Status(err) != http.StatusBadRequest {
+		t.Errorf("got %v (%d), want ErrTooDeep with 400", err, Status(err))
+	}
+
+	// an unclosed payload is malformed rather than a crash
+	err = decode(strings.Repeat(`{"a":`, 100000), DefaultLimits)
+	if err == nil || Status(err) != http.StatusBadRequest {
+		t.Errorf("got %v, want a 400", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	small := DefaultLimits
+	small.MaxBytes = 16
+	strict := DefaultLimits
+	strict.RequireJSON = true
+
+	tests := []struct {
+		name   string
+		body   string
+		limits Limits
+		header []string
+		err    error
+		status int
+	}{
+		{"empty", "  \n", DefaultLimits, nil, ErrEmpty, http.StatusBadRequest},
+		{"too large", `{"name":"` + strings.Repeat("x", 32) + `"}`, small, nil, ErrTooLarge, http.StatusRequestEntityTooLarge},
+		{"unknown field", `{"nickname":"x"}`, DefaultLimits, nil, ErrUnknownField, http.StatusBadRequest},
+		{"malformed", `{"name":`, DefaultLimits, nil, ErrMalformed, http.StatusBadRequest},
+		{"trailing data", `{"name":"x"} {}`, DefaultLimits, nil, ErrMalformed, http.StatusBadRequest},
+		{"wrong type", `{"name":1}`, DefaultLimits, nil, ErrMalformed, http.StatusBadRequest},
+		{"form content type", `{"name":"x"}`, strict, []string{"Content-Type", "application/x-www-form-urlencoded"}, ErrUnsupportedMediaType, http.StatusUnsupportedMediaType},
+		{"latin-1 charset", `{"name":"x"}`, DefaultLimits, []string{"Content-Type", "application/json; charset=latin1"}, ErrUnsupportedCharset, http.StatusUnsupportedMediaType},
+		{"invalid utf-8", "{\"name\":\"\xff\"}", DefaultLimits, nil, ErrInvalidUTF8, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		for i := 0; i+1 < len(tt.header); i += 2 {
+			r.Header.Set(tt.header[i], tt.header[i+1])
+		}
+
+		var dst struct {
+			Name string `json:"name"`
+		}
+		err := Decode(httptest.NewRecorder(), r, &dst, tt.limits)
+		if !errors.Is(err, tt.err) || Status(err) != tt.status {
+			t.Errorf("%s: got %v (%d), want %v (%d)", tt.name, err, Status(err), tt.err, tt.status)
+		}
+	}
+
+	if err := decode(`{"name":"x"}`, strict, "Content-Type", "application/merge-patch+json"); err != nil {
+		t.Errorf("+json content type: %v", err)
+	}
+	if Status(errors.New("other")) != http.StatusBadRequest {
+		t.Error("other errors should map to 400")
+	}
+}
+
+func TestCheckDepth(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat(`{"a":[`, depth/2) + strings.Repeat(`]}`, depth/2)
+	}
+
+	tests := []struct {
+		body string
+		err  error
+	}{
+		{nested(4), nil},
+		{nested(6), ErrTooDeep},
+		{`"just a string"`, nil},
+		{`{"a":[1,2,{"b":3}]}`, nil},
+		{`{"a":[`, ErrMalformed},
+	}
+	for _, tt := range tests {
+		if err := CheckDepth(strings.NewReader(tt.body), 4); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.body, err, tt.err)
+		}
+	}
+
+	// MaxDepth 0 turns the check off
+	limits := DefaultLimits
+	limits.MaxDepth = 0
+	if err := decode(nested(100), limits); err != nil {
+		t.Errorf("without a depth limit: %v", err)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var dst struct {
+		Email string `json:"email"`
+	}
+
+	if err := Unmarshal([]byte(`{"email":"a@example.com"}`), &dst); err != nil || dst.Email != "a@example.com" {
+		t.Errorf("got %+v, %v", dst, err)
+	}
+
+	tests := map[string]error{
+		`{"email":"a@example.com","admin":true}`: ErrUnknownField,
+		`{"email":"a@example.com"} {}`:           ErrMalformed,
+		`{"email":`:                              ErrMalformed,
+		``:                                       ErrMalformed,
+	}
+	for body, want := range tests {
+		if err := Unmarshal([]byte(body), &dst); !errors.Is(err, want) {
+			t.Errorf("%q: got %v, want %v", body, err, want)
+		}
+	}
+}
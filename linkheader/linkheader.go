@@ -0,0 +1,71 @@
+// Package linkheader builds RFC 8288 Link headers for the paginated lists of
+// both the people and the user APIs
+package linkheader
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Link is one target of a Link header
+type Link struct {
+	URL string
+	Rel string
+}
+
+func (l Link) String() string {
+	return fmt.Sprintf("<%s>; rel=%q", l.URL, l.Rel)
+}
+
+// Format joins links into a Link header value, "" when there are none
+func Format(links []Link) string {
+	parts := make([]string, len(links))
+	for i, l := range links {
+		parts[i] = l.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WithQuery returns the path and query of u with params set, an empty value
+// removes the param. The result is relative so it survives proxies that
+// rewrite the host.
+func WithQuery(u *url.URL, params map[string]string) string {
+	q := u.Query()
+	for k, v := range params {
+		if v == "" {
+			q.Del(k)
+		} else {
+			q.Set(k, v)
+		}
+	}
+
+	ref := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return ref.String()
+}
+
+// Offset returns the first, prev, next and last links of a limit/offset page
+// over total items. prev is left out on the first page and next on the last.
+func Offset(u *url.URL, limit, offset, total int) []Link {
+	at := func(offset int) string {
+		return WithQuery(u, map[string]string{
+			"limit":  strconv.Itoa(limit),
+			"offset": strconv.Itoa(offset),
+		})
+	}
+
+	last := 0
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+
+	links := []Link{{at(0), "first"}}
+	if offset > 0 {
+		links = append(links, Link{at(max(offset-limit, 0)), "prev"})
+	}
+	if offset+limit < total {
+		links = append(links, Link{at(offset + limit), "next"})
+	}
+	return append(links, Link{at(last), "last"})
+}
@@ -0,0 +1,56 @@
+package linkheader
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestOffset(t *testing.T) {
+	u, _ := url.Parse("http://example.com/people?city=Hanoi&limit=10&offset=20")
+
+	tests := []struct {
+		name                 string
+		limit, offset, total int
+		want                 string
+	}{
+		{"middle page", 10, 20, 45,
+			`</people?city=Hanoi&limit=10&offset=0>; rel="first", ` +
+				`</people?city=Hanoi&limit=10&offset=10>; rel="prev", ` +
+				`</people?city=Hanoi&limit=10&offset=30>; rel="next", ` +
+				`</people?city=Hanoi&limit=10&offset=40>; rel="last"`},
+		{"first page", 10, 0, 45,
+			`</people?city=Hanoi&limit=10&offset=0>; rel="first", ` +
+				`</people?city=Hanoi&limit=10&offset=10>; rel="next", ` +
+				`</people?city=Hanoi&limit=10&offset=40>; rel="last"`},
+		{"last page", 10, 40, 45,
+			`</people?city=Hanoi&limit=10&offset=0>; rel="first", ` +
+				`</people?city=Hanoi&limit=10&offset=30>; rel="prev", ` +
+				`</people?city=Hanoi&limit=10&offset=40>; rel="last"`},
+		{"uneven offset", 10, 5, 45,
+			`</people?city=Hanoi&limit=10&offset=0>; rel="first", ` +
+				`</people?city=Hanoi&limit=10&offset=0>; rel="prev", ` +
+				`</people?city=Hanoi&limit=10&offset=15>; rel="next", ` +
+				`</people?city=Hanoi&limit=10&offset=40>; rel="last"`},
+		{"empty list", 10, 0, 0,
+			`</people?city=Hanoi&limit=10&offset=0>; rel="first", ` +
+				`</people?city=Hanoi&limit=10&offset=0>; rel="last"`},
+	}
+	for _, tt := range tests {
+		if got := Format(Offset(u, tt.limit, tt.offset, tt.total)); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithQuery(t *testing.T) {
+	u, _ := url.Parse("http://example.com/users?cursor=abc&limit=5")
+	if got := WithQuery(u, map[string]string{"cursor": ""}); got != "/users?limit=5" {
+		t.Errorf("got %s", got)
+	}
+	if got := WithQuery(u, map[string]string{"cursor": "x y"}); got != "/users?cursor=x+y&limit=5" {
+		t.Errorf("got %s", got)
+	}
+	if got := Format(nil); got != "" {
+		t.Errorf("no links: got %q", got)
+	}
+}
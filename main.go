@@ -1,11 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"github.com/alexlevn/go_simplest_restapi/idgen"
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+	"github.com/alexlevn/go_simplest_restapi/linkheader"
+	"github.com/alexlevn/go_simplest_restapi/textfold"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 // Person ...
@@ -16,69 +26,526 @@ type Person struct {
 	Address   *Address `json:"address,omitempty"`
 }
 
+// UnmarshalJSON accepts the id as either a JSON string or a number, so
+// {"id":5} and {"id":"5"} both decode to ID "5". Unknown fields are rejected
+// like they are by jsonbody.Decode.
+func (p *Person) UnmarshalJSON(data []byte) error {
+	type person Person
+	aux := struct {
+		ID json.RawMessage `json:"id,omitempty"`
+		*person
+	}{person: (*person)(p)}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		return err
+	}
+
+	p.ID = ""
+	if len(aux.ID) == 0 || string(aux.ID) == "null" {
+		return nil
+	}
+
+	if aux.ID[0] == '"' {
+		return json.Unmarshal(aux.ID, &p.ID)
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(aux.ID, &n); err != nil {
+		return errors.New("person id must be a string or a number")
+	}
+	p.ID = n.String()
+	return nil
+}
+
 // Address ...
 type Address struct {
-	City  string `json:"city,omitempty"`
-	State string `json:"state,omitempty"`
+	City    string `json:"city,omitempty"`
+	State   string `json:"state,omitempty"`
+	Zip     string `json:"zip,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+var usZip = regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`)
+
+// validateZip checks the ZIP of US addresses only, as 12345 or 12345-6789
+func (a *Address) validateZip() error {
+	if a.Zip == "" {
+		return nil
+	}
+	if !strings.EqualFold(a.Country, "US") && !strings.EqualFold(a.Country, "USA") {
+		return nil
+	}
+	if !usZip.MatchString(a.Zip) {
+		return errors.New("Address zip must be 12345 or 12345-6789 for US addresses")
+	}
+	return nil
+}
+
+var people = NewPersonStore(idgen.NewSequentialIDGen(1))
+
+// acceptClientIDs keeps an id given on create instead of generating one, set
+// with ACCEPT_CLIENT_IDS=true
+var acceptClientIDs bool
+
+// filterPeople keeps the people matching the optional city, state and
+// has_address query params
+func filterPeople(req *http.Request) ([]Person, error) {
+	city := req.URL.Query().Get("city")
+	state := req.URL.Query().Get("state")
+
+	var hasAddress *bool
+	if v := req.URL.Query().Get("has_address"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("has_address must be true or false")
+		}
+		hasAddress = &b
+	}
+
+	filtered := []Person{}
+	for _, item := range people.List() {
+		if hasAddress != nil && (item.Address != nil) != *hasAddress {
+			continue
+		}
+		if city != "" && (item.Address == nil || !strings.EqualFold(item.Address.City, city)) {
+			continue
+		}
+		if state != "" && (item.Address == nil || !strings.EqualFold(item.Address.State, state)) {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered, nil
 }
 
-var people []Person
+const (
+	defaultPeoplePageSize = 20
+	maxPeoplePageSize     = 100
+)
+
+// paginatePeople applies the optional limit and offset query params and sets
+// the Link header to the neighbouring pages. Without either of them the whole
+// list is returned, like before pagination existed.
+func paginatePeople(w http.ResponseWriter, req *http.Request, list []Person) ([]Person, error) {
+	limitParam := req.URL.Query().Get("limit")
+	offsetParam := req.URL.Query().Get("offset")
+	if limitParam == "" && offsetParam == "" {
+		return list, nil
+	}
+
+	limit := defaultPeoplePageSize
+	if limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+		limit = min(n, maxPeoplePageSize)
+	}
+
+	offset := 0
+	if offsetParam != "" {
+		n, err := strconv.Atoi(offsetParam)
+		if err != nil || n < 0 {
+			return nil, errors.New("offset must be zero or a positive number")
+		}
+		offset = n
+	}
+
+	w.Header().Set("Link", linkheader.Format(linkheader.Offset(req.URL, limit, offset, len(list))))
+
+	if offset >= len(list) {
+		return []Person{}, nil
+	}
+	return list[offset:min(offset+limit, len(list))], nil
+}
 
 func getPeopleEndpoint(w http.ResponseWriter, req *http.Request) {
-	json.NewEncoder(w).Encode(&people)
+	filtered, err := filterPeople(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := paginatePeople(w, req, filtered)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(filtered)))
+	json.NewEncoder(w).Encode(&page)
+}
+
+func countPeopleEndpoint(w http.ResponseWriter, req *http.Request) {
+	filtered, err := filterPeople(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"count": len(filtered)})
+}
+
+// exportPeopleEndpoint streams every person as CSV, people without an address
+// get empty city and state columns
+func exportPeopleEndpoint(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="people.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "firstname", "lastname", "city", "state"})
+	for _, item := range people.List() {
+		var city, state string
+		if item.Address != nil {
+			city, state = item.Address.City, item.Address.State
+		}
+		cw.Write([]string{item.ID, item.Firstname, item.Lastname, city, state})
+	}
+	cw.Flush()
+}
+
+func getPersonByNameEndpoint(w http.ResponseWriter, req *http.Request) {
+	firstname := req.URL.Query().Get("firstname")
+	lastname := req.URL.Query().Get("lastname")
+	if firstname == "" && lastname == "" {
+		http.Error(w, "firstname or lastname is required", http.StatusBadRequest)
+		return
+	}
+
+	matches := []Person{}
+	for _, item := range people.List() {
+		if firstname != "" && !textfold.Equal(item.Firstname, firstname) {
+			continue
+		}
+		if lastname != "" && !textfold.Equal(item.Lastname, lastname) {
+			continue
+		}
+		matches = append(matches, item)
+	}
+
+	if len(matches) == 0 {
+		http.Error(w, "Person not found", http.StatusNotFound)
+		return
+	}
+
+	if req.URL.Query().Get("all") == "true" {
+		json.NewEncoder(w).Encode(matches)
+		return
+	}
+	json.NewEncoder(w).Encode(matches[0])
+}
+
+// personDTO is the GET /people/{id} response, Address is left out with ?expand=false
+type personDTO struct {
+	ID        string   `json:"id,omitempty"`
+	Firstname string   `json:"firstname,omitempty"`
+	Lastname  string   `json:"lastname,omitempty"`
+	Address   *Address `json:"address,omitempty"`
+}
+
+func newPersonDTO(p Person, expand bool) personDTO {
+	dto := personDTO{ID: p.ID, Firstname: p.Firstname, Lastname: p.Lastname}
+	if expand {
+		dto.Address = p.Address
+	}
+	return dto
 }
 
 func getPersonEndpoint(w http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
-	for _, item := range people {
-		if item.ID == params["id"] {
-			json.NewEncoder(w).Encode(item)
+
+	expand := true
+	if v := req.URL.Query().Get("expand"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "expand must be true or false", http.StatusBadRequest)
+			return
+		}
+		expand = b
+	}
+
+	item, err := people.Get(params["id"])
+	if err != nil {
+		json.NewEncoder(w).Encode(&Person{})
+		return
+	}
+	json.NewEncoder(w).Encode(newPersonDTO(item, expand))
+}
+
+func createPersonEndpoint(limits jsonbody.Limits) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var person Person
+		if err := jsonbody.Decode(w, req, &person, limits); err != nil {
+			http.Error(w, err.Error(), jsonbody.Status(err))
+			return
+		}
+
+		if person.Address != nil {
+			if err := person.Address.validateZip(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		warnDuplicates := req.URL.Query().Get("warn_duplicates") == "true"
+		var warnings []string
+		if warnDuplicates {
+			warnings = duplicateNameWarnings(person)
+		}
+
+		if !acceptClientIDs {
+			person.ID = ""
+		}
+
+		person, err := people.Create(person)
+		if errors.Is(err, ErrPersonExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		peopleEvents.publish("created", person)
+
+		if !warnDuplicates {
+			json.NewEncoder(w).Encode(person)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(createdPerson{Person: person, Warnings: warnings})
+	}
+}
+
+// createdPerson is the ?warn_duplicates=true response, the person plus any warnings
+type createdPerson struct {
+	Person
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// duplicateNameWarnings lists the people already stored with the same first
+// and last name as p. A duplicate name does not block creation.
+func duplicateNameWarnings(p Person) []string {
+	var warnings []string
+	for _, item := range people.List() {
+		if strings.EqualFold(item.Firstname, p.Firstname) && strings.EqualFold(item.Lastname, p.Lastname) {
+			warnings = append(warnings, "Person "+item.ID+" has the same first and last name")
+		}
+	}
+	return warnings
+}
+
+func updatePersonAddressEndpoint(limits jsonbody.Limits) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		params := mux.Vars(req)
+
+		var address Address
+		if err := jsonbody.Decode(w, req, &address, limits); err != nil {
+			http.Error(w, err.Error(), jsonbody.Status(err))
+			return
+		}
+		if address.City == "" || address.State == "" {
+			http.Error(w, "Address city and state cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if err := address.validateZip(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+
+		person, err := people.Update(params["id"], func(p *Person) error {
+			p.Address = &address
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		peopleEvents.publish("updated", person)
+		json.NewEncoder(w).Encode(person)
+	}
+}
+
+// PersonPatch holds the fields to change. Fields left out are kept, fields
+// sent as null are cleared.
+type PersonPatch struct {
+	Firstname Optional[string]       `json:"firstname"`
+	Lastname  Optional[string]       `json:"lastname"`
+	Address   Optional[AddressPatch] `json:"address"`
+}
+
+// AddressPatch is merged into the current address instead of replacing it,
+// a null address removes it altogether
+type AddressPatch struct {
+	City    Optional[string] `json:"city"`
+	State   Optional[string] `json:"state"`
+	Zip     Optional[string] `json:"zip"`
+	Country Optional[string] `json:"country"`
+}
+
+// apply returns p with the patch applied, p itself is left untouched
+func (pp *PersonPatch) apply(p Person) Person {
+	pp.Firstname.applyTo(&p.Firstname)
+	pp.Lastname.applyTo(&p.Lastname)
+
+	switch {
+	case !pp.Address.Set:
+	case pp.Address.Null:
+		if nullClears {
+			p.Address = nil
+		}
+	default:
+		address := Address{}
+		if p.Address != nil {
+			address = *p.Address
+		}
+		pp.Address.Value.City.applyTo(&address.City)
+		pp.Address.Value.State.applyTo(&address.State)
+		pp.Address.Value.Zip.applyTo(&address.Zip)
+		pp.Address.Value.Country.applyTo(&address.Country)
+		p.Address = &address
 	}
-	json.NewEncoder(w).Encode(&Person{})
+
+	return p
 }
 
-func createPersonEndpoint(w http.ResponseWriter, req *http.Request) {
-	var person Person
-	_ = json.NewDecoder(req.Body).Decode(&person)
-	person.ID = fmt.Sprintf("%d", len(people)+1)
-	people = append(people, person)
-	json.NewEncoder(w).Encode(person)
+func patchPersonEndpoint(limits jsonbody.Limits) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		params := mux.Vars(req)
+
+		var patch PersonPatch
+		if err := jsonbody.Decode(w, req, &patch, limits); err != nil {
+			http.Error(w, err.Error(), jsonbody.Status(err))
+			return
+		}
+
+		patched, err := people.Update(params["id"], func(p *Person) error {
+			*p = patch.apply(*p)
+			if p.Address != nil {
+				return p.Address.validateZip()
+			}
+			return nil
+		})
+		if errors.Is(err, ErrPersonNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		peopleEvents.publish("updated", patched)
+		json.NewEncoder(w).Encode(patched)
+	}
 }
 
 func deletePersonEndpoint(w http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
-	for index, item := range people {
-		if item.ID == params["id"] {
-			people = append(people[:index], people[index+1:]...)
+	if item, err := people.Delete(params["id"]); err == nil {
+		peopleEvents.publish("deleted", item)
+	}
+	json.NewEncoder(w).Encode(people.List())
+}
+
+// renumberPeopleEndpoint closes the gaps deletions leave in the ids, it
+// answers with the old id of each person mapped to the new one. Everyone
+// whose id changed is published as a "renumbered" event.
+func renumberPeopleEndpoint(w http.ResponseWriter, req *http.Request) {
+	mapping := people.Renumber()
+
+	oldIDs := make(map[string]string, len(mapping))
+	for oldID, newID := range mapping {
+		if oldID != newID {
+			oldIDs[newID] = oldID
 		}
 	}
-	json.NewEncoder(w).Encode(people)
+	for _, p := range people.List() {
+		if oldID, ok := oldIDs[p.ID]; ok {
+			peopleEvents.publishRenumbered(p, oldID)
+		}
+	}
+
+	json.NewEncoder(w).Encode(mapping)
+}
+
+// newRouter registers the people routes, dev adds the HTML page on /ui.
+// limits applies to every JSON request body.
+func newRouter(dev bool, limits jsonbody.Limits) *mux.Router {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/people", cacheable(getPeopleEndpoint)).Methods("GET")
+	router.HandleFunc("/people/count", countPeopleEndpoint).Methods("GET")
+	router.HandleFunc("/people/by-name", getPersonByNameEndpoint).Methods("GET")
+	router.HandleFunc("/people/events", peopleEventsEndpoint).Methods("GET")
+	router.HandleFunc("/people/export.csv", exportPeopleEndpoint).Methods("GET")
+	router.HandleFunc("/people/{id}", cacheable(getPersonEndpoint)).Methods("GET")
+	router.HandleFunc("/people/add", noStore(createPersonEndpoint(limits))).Methods("POST")
+	router.HandleFunc("/people/{id}", noStore(deletePersonEndpoint)).Methods("DELETE")
+	router.HandleFunc("/people/{id}", noStore(patchPersonEndpoint(limits))).Methods("PATCH")
+	if adminToken != "" {
+		router.HandleFunc("/admin/people/renumber", noStore(requireAdmin(renumberPeopleEndpoint))).Methods("POST")
+	}
+	if dev {
+		router.HandleFunc("/ui", uiEndpoint).Methods("GET")
+	}
+	router.HandleFunc("/people/{id}/address", noStore(updatePersonAddressEndpoint(limits))).Methods("PUT")
+
+	return router
 }
 
 func main() {
 	println("Recoding the REST API in 5 minutes")
-	router := mux.NewRouter()
 
-	people = append(people, Person{ID: "1", Firstname: "Alex", Lastname: "Lee", Address: &Address{City: "Ho Chi Minh", State: "Tan Phu"}})
-	people = append(people, Person{ID: "2", Firstname: "Minh", Lastname: "Le"})
+	acceptClientIDs = os.Getenv("ACCEPT_CLIENT_IDS") == "true"
+	nullClears = os.Getenv("PATCH_NULL") != "ignore"
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	if v := os.Getenv("CACHE_MAX_AGE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cacheMaxAge = n
+	}
+	// MAX_JSON_DEPTH changes how deeply a request body may nest
+	limits := jsonbody.DefaultLimits
+	if v := os.Getenv("MAX_JSON_DEPTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		limits.MaxDepth = n
+	}
 
-	router.HandleFunc("/people", getPeopleEndpoint).Methods("GET")
-	router.HandleFunc("/people/{id}", getPersonEndpoint).Methods("GET")
-	router.HandleFunc("/people/add", createPersonEndpoint).Methods("POST")
-	router.HandleFunc("/people/{id}", deletePersonEndpoint).Methods("DELETE")
+	people.Create(Person{Firstname: "Alex", Lastname: "Lee", Address: &Address{City: "Ho Chi Minh", State: "Tan Phu"}})
+	people.Create(Person{Firstname: "Minh", Lastname: "Le"})
 
-	log.Fatal(http.ListenAndServe(":8888", router))
+	log.Fatal(http.ListenAndServe(":8888", newRouter(os.Getenv("DEV") == "true", limits)))
 }
 
 /*
 Get people list:
 	GET http://localhost:8888/people
 
+Filter people by address (case-insensitive):
+	GET http://localhost:8888/people?city=Ho Chi Minh&state=Tan Phu
+
+Only people with (or without) an address:
+	GET http://localhost:8888/people?has_address=true
+	GET http://localhost:8888/people?has_address=false
+
+Count people, honoring the same filters:
+	GET http://localhost:8888/people/count
+	GET http://localhost:8888/people/count?city=Ho Chi Minh
+
 Get person:
 	GET http://localhost:8888/people/1
 
+Get person without the address:
+	GET http://localhost:8888/people/1?expand=false
+
+Get person by name (case- and accent-insensitive, first match or all matches with all=true):
+	GET http://localhost:8888/people/by-name?firstname=Alex&lastname=Lee
+	GET http://localhost:8888/people/by-name?lastname=le&all=true
+
 Create person:
 	POST http://localhost:8888/people/add
 
@@ -92,6 +559,23 @@ Create person:
 		}
 	}
 
+Move a person (replaces only the address):
+	PUT http://localhost:8888/people/1/address
+
+	JSON Body
+	{
+		"city": "Da Nang",
+		"state": "Hai Chau"
+	}
+
+	US addresses may carry a ZIP, 12345 or 12345-6789
+	{
+		"city": "Seattle",
+		"state": "WA",
+		"zip": "98101",
+		"country": "US"
+	}
+
 Detelet DELETE http://localhost:8888/people/3
 
 TEST COMMANDS:
@@ -99,13 +583,50 @@ TEST COMMANDS:
 Get people
 ~/ curl localhost:8888/people
 
+Get people, one page at a time (X-Total-Count has the full count, Link the first/prev/next/last pages)
+~/ curl -i localhost:8888/people?limit=2\&offset=2
+
+Export people as CSV
+~/ curl -OJ localhost:8888/people/export.csv
+
 Get person detail
 ~/ curl localhost:8888/person/2
 
 Create new person
 ~/ curl -XPOST -d '{"Firstname":"ABC", "Lastname":"Tran", "Address": {"city": "HCM", "state":"hcm"}}' localhost:8888/people/add
 
+Bodies nesting deeper than MAX_JSON_DEPTH (default 32) objects/arrays get 400
+~/ MAX_JSON_DEPTH=4 go run .
+
+Create new person with its own id (needs ACCEPT_CLIENT_IDS=true, 409 when the id is taken)
+~/ curl -XPOST -d '{"id":"42", "Firstname":"ABC", "Lastname":"Tran"}' localhost:8888/people/add
+
+Create new person, warning about people with the same name
+~/ curl -XPOST -d '{"Firstname":"ABC", "Lastname":"Tran"}' localhost:8888/people/add?warn_duplicates=true
+
+Change only some fields of a person, the address is merged field by field
+~/ curl -XPATCH -d '{"firstname":"Alexander"}' localhost:8888/people/1
+~/ curl -XPATCH -d '{"address":{"city":"Da Nang"}}' localhost:8888/people/1
+A null clears the field, or removes the whole address (PATCH_NULL=ignore treats null as left out)
+~/ curl -XPATCH -d '{"address":{"state":null}}' localhost:8888/people/1
+~/ curl -XPATCH -d '{"address":null}' localhost:8888/people/1
+
 Delete person
 ~/ curl -XDELETE localhost:8888/people/3
 
+Give people the ids 1..N again after deletions, answers {"old id": "new id"} (only with ADMIN_TOKEN set)
+~/ ADMIN_TOKEN=secret go run .
+~/ curl -XPOST -H "Authorization: Bearer secret" localhost:8888/admin/people/renumber
+
+A small HTML page listing people with a form to add one (only with DEV=true)
+~/ DEV=true go run .
+~/ open http://localhost:8888/ui
+
+GET /people and /people/{id} may be cached for CACHE_MAX_AGE seconds (default 0, revalidate every time), changes are never cached
+~/ CACHE_MAX_AGE=30 go run .
+~/ curl -i localhost:8888/people
+
+Watch people being created, updated and deleted (server-sent events)
+~/ curl -N localhost:8888/people/events
+
 */
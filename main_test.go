@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexlevn/go_simplest_restapi/idgen"
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+// withPeople swaps in a fresh store holding list for the rest of the test
+func withPeople(t *testing.T, list ...Person) {
+	t.Helper()
+
+	saved := people
+	people = NewPersonStore(idgen.NewSequentialIDGen(1))
+	t.Cleanup(func() { people = saved })
+
+	for _, p := range list {
+		if _, err := people.Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// serve sends one request through the people router
+func serve(method, target, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	newRouter(false, jsonbody.DefaultLimits).ServeHTTP(w, r)
+	return w
+}
+
+// samplePeople are the people main starts with, plus one more in Hanoi
+var samplePeople = []Person{
+	{Firstname: "Alex", Lastname: "Lee", Address: &Address{City: "Ho Chi Minh", State: "Tan Phu"}},
+	{Firstname: "Minh", Lastname: "Le"},
+	{Firstname: "Lan", Lastname: "Tran", Address: &Address{City: "Hanoi", State: "Ba Dinh"}},
+}
+
+func TestPersonIDForms(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"id":"5","firstname":"Alex"}`, "5"},
+		{`{"id":5,"firstname":"Alex"}`, "5"},
+		{`{"id":12345678901234567890}`, "12345678901234567890"},
+		{`{"id":null}`, ""},
+		{`{"firstname":"Alex"}`, ""},
+	}
+	for _, tt := range tests {
+		var p Person
+		if err := json.Unmarshal([]byte(tt.body), &p); err != nil {
+			t.Errorf("%s: %v", tt.body, err)
+			continue
+		}
+		if p.ID != tt.want {
+			t.Errorf("%s: id %q, want %q", tt.body, p.ID, tt.want)
+		}
+	}
+
+	for _, body := range []string{`{"id":true}`, `{"id":{}}`, `{"nickname":"x"}`} {
+		var p Person
+		if err := json.Unmarshal([]byte(body), &p); err == nil {
+			t.Errorf("%s: decoded as %+v, want an error", body, p)
+		}
+	}
+
+	// ids are always written back as strings
+	data, _ := json.Marshal(Person{ID: "5"})
+	if string(data) != `{"id":"5"}` {
+		t.Errorf("got %s", data)
+	}
+}
+
+func TestCountPeople(t *testing.T) {
+	withPeople(t, samplePeople...)
+
+	tests := map[string]string{
+		"/people/count":                      `{"count":3}`,
+		"/people/count?city=ho%20chi%20minh": `{"count":1}`,
+		"/people/count?has_address=true":     `{"count":2}`,
+		"/people/count?city=Hanoi&state=Hue": `{"count":0}`,
+	}
+	for target, want := range tests {
+		w := serve(http.MethodGet, target, "")
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != want {
+			t.Errorf("GET %s: got %d %s, want %s", target, w.Code, w.Body, want)
+		}
+	}
+
+	if w := serve(http.MethodGet, "/people/count?has_address=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("bad filter: got %d, want 400", w.Code)
+	}
+}
+
+func TestPersonByName(t *testing.T) {
+	withPeople(t, samplePeople...)
+
+	w := serve(http.MethodGet, "/people/by-name?firstname=alex&lastname=LEE", "")
+	var p Person
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if p.Firstname != "Alex" || p.Lastname != "Lee" {
+		t.Errorf("got %+v", p)
+	}
+
+	if w := serve(http.MethodGet, "/people/by-name?firstname=Nobody", ""); w.Code != http.StatusNotFound {
+		t.Errorf("no match: got %d, want 404", w.Code)
+	}
+	if w := serve(http.MethodGet, "/people/by-name", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("no name: got %d, want 400", w.Code)
+	}
+}
+
+func TestPeopleHasAddress(t *testing.T) {
+	withPeople(t, samplePeople...)
+
+	tests := map[string][]string{
+		"true":  {"Alex", "Lan"},
+		"false": {"Minh"},
+	}
+	for v, want := range tests {
+		w := serve(http.MethodGet, "/people?has_address="+v, "")
+		var list []Person
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("has_address=%s: %s", v, w.Body)
+		}
+		var got []string
+		for _, p := range list {
+			got = append(got, p.Firstname)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("has_address=%s: got %v, want %v", v, got, want)
+		}
+	}
+
+	if w := serve(http.MethodGet, "/people?has_address=yes", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("bad value: got %d, want 400", w.Code)
+	}
+}
+
+func TestUpdatePersonAddress(t *testing.T) {
+	withPeople(t, samplePeople...)
+
+	w := serve(http.MethodPut, "/people/2/address", `{"city":"Da Nang","state":"Hai Chau"}`)
+	var p Person
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if p.Firstname != "Minh" || p.Lastname != "Le" || p.Address == nil || p.Address.City != "Da Nang" {
+		t.Errorf("got %+v", p)
+	}
+
+	if w := serve(http.MethodPut, "/people/99/address", `{"city":"Hue","state":"Thua Thien"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown id: got %d, want 404", w.Code)
+	}
+	if w := serve(http.MethodPut, "/people/1/address", `{"city":"Hue"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("no state: got %d, want 400", w.Code)
+	}
+}
+
+// firstnames decodes a list of people and returns their first names
+func firstnames(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+
+	var list []Person
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	names := []string{}
+	for _, p := range list {
+		names = append(names, p.Firstname)
+	}
+	return names
+}
+
+func TestPeoplePages(t *testing.T) {
+	withPeople(t, samplePeople...)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/people", "Alex,Minh,Lan"},
+		{"/people?limit=1&offset=1", "Minh"},
+		{"/people?limit=2&offset=2", "Lan"},
+		{"/people?limit=2&offset=5", ""},
+		{"/people?offset=1", "Minh,Lan"},
+	}
+	for _, tt := range tests {
+		w := serve(http.MethodGet, tt.target, "")
+		if got := strings.Join(firstnames(t, w), ","); got != tt.want {
+			t.Errorf("GET %s: got %q, want %q", tt.target, got, tt.want)
+		}
+		if total := w.Header().Get("X-Total-Count"); total != "3" {
+			t.Errorf("GET %s: X-Total-Count %q, want 3", tt.target, total)
+		}
+	}
+
+	w := serve(http.MethodGet, "/people?limit=1&offset=1", "")
+	if link := w.Header().Get("Link"); !strings.Contains(link, `rel="next"`) || !strings.Contains(link, `rel="prev"`) {
+		t.Errorf("middle page Link: %q", link)
+	}
+
+	for _, target := range []string{"/people?limit=0", "/people?offset=-1", "/people?limit=x"} {
+		if w := serve(http.MethodGet, target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: got %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestCreatePersonWarnDuplicates(t *testing.T) {
+	withPeople(t, samplePeople...)
+
+	// only warn_duplicates answers 201, plain creates keep their 200
+	tests := []struct {
+		target   string
+		body     string
+		status   int
+		warnings []string
+	}{
+		{"/people/add", `{"firstname":"alex","lastname":"LEE"}`, http.StatusOK, nil},
+		{"/people/add?warn_duplicates=true", `{"firstname":"Tuan","lastname":"Vo"}`, http.StatusCreated, nil},
+		{"/people/add?warn_duplicates=true", `{"firstname":"alex","lastname":"LEE"}`, http.StatusCreated, []string{"Person 1 has the same first and last name", "Person 4 has the same first and last name"}},
+	}
+	for _, tt := range tests {
+		w := serve(http.MethodPost, tt.target, tt.body)
+		// createdPerson would decode through Person's UnmarshalJSON and drop the warnings
+		var created struct {
+			ID       string   `json:"id"`
+			Warnings []string `json:"warnings"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != tt.status {
+			t.Fatalf("POST %s: got %d %s", tt.target, w.Code, w.Body)
+		}
+		if created.ID == "" || strings.Join(created.Warnings, "|") != strings.Join(tt.warnings, "|") {
+			t.Errorf("POST %s %s: got %+v", tt.target, tt.body, created)
+		}
+	}
+}
+
+func TestPersonByNameAccents(t *testing.T) {
+	withPeople(t, Person{Firstname: "José", Lastname: "Nguyễn"})
+
+	w := serve(http.MethodGet, "/people/by-name?firstname=jose&lastname=nguyen", "")
+	var p Person
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	// the stored names are returned untouched
+	if p.Firstname != "José" || p.Lastname != "Nguyễn" {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestCreatePersonClientIDs(t *testing.T) {
+	withPeople(t, samplePeople...)
+	defer func(saved bool) { acceptClientIDs = saved }(acceptClientIDs)
+
+	acceptClientIDs = false
+	w := serve(http.MethodPost, "/people/add", `{"id":"1","firstname":"Tuan"}`)
+	var p Person
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK || p.ID == "1" {
+		t.Errorf("ignored id: got %d %s", w.Code, w.Body)
+	}
+
+	acceptClientIDs = true
+	w = serve(http.MethodPost, "/people/add", `{"id":"abc","firstname":"Hoa"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK || p.ID != "abc" {
+		t.Errorf("client id: got %d %s", w.Code, w.Body)
+	}
+	if w := serve(http.MethodPost, "/people/add", `{"id":"abc","firstname":"Hoa"}`); w.Code != http.StatusConflict {
+		t.Errorf("taken id: got %d, want 409", w.Code)
+	}
+	if w := serve(http.MethodPost, "/people/add", `{"firstname":"Nam"}`); w.Code != http.StatusOK {
+		t.Errorf("no id: got %d, want 200", w.Code)
+	}
+}
+
+func TestPersonZip(t *testing.T) {
+	withPeople(t)
+
+	tests := []struct {
+		address string
+		status  int
+	}{
+		{`{"city":"Austin","state":"TX","zip":"78701","country":"US"}`, http.StatusOK},
+		{`{"city":"Austin","state":"TX","zip":"78701-1234","country":"US"}`, http.StatusOK},
+		{`{"city":"Austin","state":"TX","country":"US"}`, http.StatusOK},
+		{`{"city":"Hanoi","state":"Ba Dinh","zip":"100000","country":"VN"}`, http.StatusOK},
+		{`{"city":"Austin","state":"TX","zip":"7870","country":"US"}`, http.StatusBadRequest},
+		{`{"city":"Austin","state":"TX","zip":"78701-12","country":"US"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(http.MethodPost, "/people/add", `{"firstname":"A","address":`+tt.address+`}`); w.Code != tt.status {
+			t.Errorf("create with %s: got %d, want %d", tt.address, w.Code, tt.status)
+		}
+	}
+
+	if w := serve(http.MethodPut, "/people/1/address", `{"city":"Austin","state":"TX","zip":"abcde","country":"US"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("update with a bad zip: got %d, want 400", w.Code)
+	}
+}
+
+func TestExportPeopleCSV(t *testing.T) {
+	withPeople(t, append(samplePeople, Person{Firstname: "Quoc, Anh", Lastname: `"Tiny"`})...)
+
+	w := serve(http.MethodGet, "/people/export.csv", "")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="people.csv"`) {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "firstname", "lastname", "city", "state"},
+		{"1", "Alex", "Lee", "Ho Chi Minh", "Tan Phu"},
+		{"2", "Minh", "Le", "", ""},
+		{"3", "Lan", "Tran", "Hanoi", "Ba Dinh"},
+		{"4", "Quoc, Anh", `"Tiny"`, "", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q", records)
+	}
+}
+
+func TestGetPersonExpand(t *testing.T) {
+	withPeople(t, samplePeople...)
+
+	tests := map[string]string{
+		"/people/1":              `{"id":"1","firstname":"Alex","lastname":"Lee","address":{"city":"Ho Chi Minh","state":"Tan Phu"}}`,
+		"/people/1?expand=true":  `{"id":"1","firstname":"Alex","lastname":"Lee","address":{"city":"Ho Chi Minh","state":"Tan Phu"}}`,
+		"/people/1?expand=false": `{"id":"1","firstname":"Alex","lastname":"Lee"}`,
+	}
+	for target, want := range tests {
+		w := serve(http.MethodGet, target, "")
+		if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || got != want {
+			t.Errorf("GET %s: got %d %s, want %s", target, w.Code, got, want)
+		}
+	}
+
+	if w := serve(http.MethodGet, "/people/1?expand=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("bad expand: got %d, want 400", w.Code)
+	}
+}
+
+func TestCreatePersonTooDeep(t *testing.T) {
+	withPeople(t)
+	limits := jsonbody.DefaultLimits
+	limits.MaxDepth = 2
+	router := newRouter(false, limits)
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/people/add", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"firstname":"A","address":{"city":"Hue","state":"Hue"}}`); w.Code != http.StatusOK {
+		t.Errorf("depth 2: got %d %s, want 200", w.Code, w.Body)
+	}
+	if w := post(`{"firstname":"A","address":{"city":{"x":[1]}}}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "nested too deeply") {
+		t.Errorf("depth 4: got %d %s, want 400", w.Code, w.Body)
+	}
+}
+
+func TestPatchPerson(t *testing.T) {
+	withPeople(t, samplePeople...)
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"firstname":"Alexander"}`, `{"id":"1","firstname":"Alexander","lastname":"Lee","address":{"city":"Ho Chi Minh","state":"Tan Phu"}}`},
+		{`{"address":{"state":"Quan 1"}}`, `{"id":"1","firstname":"Alexander","lastname":"Lee","address":{"city":"Ho Chi Minh","state":"Quan 1"}}`},
+		{`{}`, `{"id":"1","firstname":"Alexander","lastname":"Lee","address":{"city":"Ho Chi Minh","state":"Quan 1"}}`},
+	}
+	for _, tt := range tests {
+		w := serve(http.MethodPatch, "/people/1", tt.body)
+		if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || got != tt.want {
+			t.Errorf("PATCH %s: got %d %s, want %s", tt.body, w.Code, got, tt.want)
+		}
+	}
+
+	// a person without an address gets one from the patch
+	w := serve(http.MethodPatch, "/people/2", `{"address":{"city":"Hue"}}`)
+	if got := strings.TrimSpace(w.Body.String()); got != `{"id":"2","firstname":"Minh","lastname":"Le","address":{"city":"Hue"}}` {
+		t.Errorf("new address: got %s", got)
+	}
+
+	if w := serve(http.MethodPatch, "/people/99", `{"firstname":"X"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown id: got %d, want 404", w.Code)
+	}
+	if w := serve(http.MethodPatch, "/people/1", `{"address":{"country":"US","zip":"1"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("bad zip: got %d, want 400", w.Code)
+	}
+}
+
+func TestCreatePersonInvalidUTF8(t *testing.T) {
+	withPeople(t)
+
+	if w := serve(http.MethodPost, "/people/add", "{\"firstname\":\"L\xe0n\"}"); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d %s, want 400", w.Code, w.Body)
+	}
+	if n := len(people.List()); n != 0 {
+		t.Errorf("%d people created", n)
+	}
+}
+
+func TestRenumberPeople(t *testing.T) {
+	withPeople(t, append(samplePeople, Person{Firstname: "Hoa"})...)
+	people.Delete("1")
+	people.Delete("3")
+
+	defer func(saved string) { adminToken = saved }(adminToken)
+	adminToken = ""
+	if w := serve(http.MethodPost, "/admin/people/renumber", ""); w.Code != http.StatusNotFound {
+		t.Errorf("without ADMIN_TOKEN: got %d, want 404", w.Code)
+	}
+
+	adminToken = "s3cret"
+	if w := serve(http.MethodPost, "/admin/people/renumber", "", "Authorization", "Bearer wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: got %d, want 401", w.Code)
+	}
+
+	events := peopleEvents.subscribe()
+	defer peopleEvents.unsubscribe(events)
+
+	w := serve(http.MethodPost, "/admin/people/renumber", "", "Authorization", "Bearer s3cret")
+	var mapping map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &mapping); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if !reflect.DeepEqual(mapping, map[string]string{"2": "1", "4": "2"}) {
+		t.Errorf("mapping %v", mapping)
+	}
+
+	var got []string
+	for _, p := range people.List() {
+		got = append(got, p.ID+"="+p.Firstname)
+	}
+	if strings.Join(got, " ") != "1=Minh 2=Hoa" {
+		t.Errorf("after renumbering: %v", got)
+	}
+
+	for _, want := range []personEvent{
+		{Type: "renumbered", Person: Person{ID: "1", Firstname: "Minh", Lastname: "Le"}, OldID: "2"},
+		{Type: "renumbered", Person: Person{ID: "2", Firstname: "Hoa"}, OldID: "4"},
+	} {
+		select {
+		case ev := <-events:
+			if !reflect.DeepEqual(ev, want) {
+				t.Errorf("got event %+v, want %+v", ev, want)
+			}
+		default:
+			t.Errorf("missing event for %s", want.Person.Firstname)
+		}
+	}
+
+	// new people carry on from the last id
+	p, _ := people.Create(Person{Firstname: "Nam"})
+	if p.ID != "3" {
+		t.Errorf("next id %s, want 3", p.ID)
+	}
+}
+
+func TestPatchPersonNull(t *testing.T) {
+	defer func(saved bool) { nullClears = saved }(nullClears)
+
+	tests := []struct {
+		nullClears bool
+		body       string
+		want       string
+	}{
+		{true, `{"firstname":"Alexander"}`, `{"city":"Ho Chi Minh","state":"Tan Phu"}`},
+		{true, `{"address":{"city":"Hue"}}`, `{"city":"Hue","state":"Tan Phu"}`},
+		{true, `{"address":{"state":null}}`, `{"city":"Ho Chi Minh"}`},
+		{true, `{"address":null}`, `null`},
+		{false, `{"address":null}`, `{"city":"Ho Chi Minh","state":"Tan Phu"}`},
+		{false, `{"address":{"state":null}}`, `{"city":"Ho Chi Minh","state":"Tan Phu"}`},
+	}
+	for _, tt := range tests {
+		withPeople(t, samplePeople...)
+		nullClears = tt.nullClears
+
+		w := serve(http.MethodPatch, "/people/1", tt.body)
+		var p Person
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("PATCH %s: got %d %s", tt.body, w.Code, w.Body)
+		}
+		if got, _ := json.Marshal(p.Address); string(got) != tt.want {
+			t.Errorf("nullClears %v, PATCH %s: address %s, want %s", tt.nullClears, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package memstore is a mutex-guarded map shared by the in-memory storers
+package memstore
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNotFound ...
+	ErrNotFound = errors.New("Not found")
+	// ErrKeyExists is returned by Update when the new key is already taken
+	ErrKeyExists = errors.New("Key already exists")
+)
+
+// Store holds values under the key extracted from them. Values are never
+// modified in place by the store, so callers that treat them as immutable can
+// share them freely.
+type Store[K comparable, V any] struct {
+	mu    sync.RWMutex
+	items map[K]V
+	key   func(V) K
+}
+
+// New returns an empty Store that files each value under key(value)
+func New[K comparable, V any](key func(V) K) *Store[K, V] {
+	return &Store[K, V]{
+		items: map[K]V{},
+		key:   key,
+	}
+}
+
+// Get ...
+func (s *Store[K, V]) Get(k K) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.items[k]
+	return v, ok
+}
+
+// Save inserts or replaces v
+func (s *Store[K, V]) Save(v V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[s.key(v)] = v
+}
+
+// Insert stores v unless its key is taken, in one step, and reports whether
+// it did
+func (s *Store[K, V]) Insert(v V) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := s.key(v)
+	if _, taken := s.items[k]; taken {
+		return false
+	}
+	s.items[k] = v
+	return true
+}
+
+// Delete returns the value that was under k and reports whether there was one
+func (s *Store[K, V]) Delete(k K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.items[k]
+	if ok {
+		delete(s.items, k)
+	}
+	return v, ok
+}
+
+// List snapshots every value under a short read lock, in no particular order
+func (s *Store[K, V]) List() []V {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]V, 0, len(s.items))
+	for _, v := range s.items {
+		list = append(list, v)
+	}
+	return list
+}
+
+// Count ...
+func (s *Store[K, V]) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.items)
+}
+
+// Update replaces the value under k with what fn returns, in one step. When
+// the new value has a different key it is moved there, unless that key is
+// taken. It may return ErrNotFound, ErrKeyExists or whatever fn returns.
+func (s *Store[K, V]) Update(k K, fn func(V) (V, error)) (V, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var zero V
+	old, ok := s.items[k]
+	if !ok {
+		return zero, ErrNotFound
+	}
+
+	updated, err := fn(old)
+	if err != nil {
+		return zero, err
+	}
+
+	newKey := s.key(updated)
+	if newKey != k {
+		if _, taken := s.items[newKey]; taken {
+			return zero, ErrKeyExists
+		}
+		delete(s.items, k)
+	}
+
+	s.items[newKey] = updated
+	return updated, nil
+}
+
+// Merge replaces the value under into with what fn returns from it and the
+// value under from, then deletes from, in one step. fn must keep the key of
+// into. It may return ErrNotFound or whatever fn returns.
+func (s *Store[K, V]) Merge(into, from K, fn func(into, from V) (V, error)) (V, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var zero V
+	v, ok := s.items[into]
+	if !ok {
+		return zero, ErrNotFound
+	}
+	other, ok := s.items[from]
+	if !ok {
+		return zero, ErrNotFound
+	}
+
+	merged, err := fn(v, other)
+	if err != nil {
+		return zero, err
+	}
+
+	delete(s.items, from)
+	s.items[into] = merged
+	return merged, nil
+}
+
+// Replace swaps every value for the ones fn returns, in one step. fn gets a
+// snapshot of the values in no particular order, when two of the values it
+// returns share a key the last one wins.
+func (s *Store[K, V]) Replace(fn func([]V) []V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]V, 0, len(s.items))
+	for _, v := range s.items {
+		list = append(list, v)
+	}
+
+	items := make(map[K]V, len(list))
+	for _, v := range fn(list) {
+		items[s.key(v)] = v
+	}
+	s.items = items
+}
@@ -0,0 +1,145 @@
+package memstore
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+type user struct {
+	Email string
+	Name  string
+}
+
+type person struct {
+	ID        int
+	Firstname string
+}
+
+func TestStoreStringKeys(t *testing.T) {
+	s := New(func(u *user) string { return u.Email })
+
+	s.Save(&user{Email: "a@example.com", Name: "A"})
+	s.Save(&user{Email: "a@example.com", Name: "A2"})
+	if !s.Insert(&user{Email: "b@example.com", Name: "B"}) {
+		t.Error("Insert of a new key failed")
+	}
+	if s.Insert(&user{Email: "b@example.com", Name: "B2"}) {
+		t.Error("Insert over a taken key succeeded")
+	}
+
+	if u, ok := s.Get("a@example.com"); !ok || u.Name != "A2" {
+		t.Errorf("Get: %+v, %v", u, ok)
+	}
+	if u, _ := s.Get("b@example.com"); u.Name != "B" {
+		t.Errorf("Insert replaced the value: %+v", u)
+	}
+	if _, ok := s.Get("none@example.com"); ok {
+		t.Error("Get of a missing key succeeded")
+	}
+
+	if s.Count() != 2 || len(s.List()) != 2 {
+		t.Errorf("Count %d, List %d, want 2", s.Count(), len(s.List()))
+	}
+	if u, ok := s.Delete("a@example.com"); !ok || u.Name != "A2" {
+		t.Errorf("Delete: %+v, %v", u, ok)
+	}
+	if _, ok := s.Delete("a@example.com"); ok || s.Count() != 1 {
+		t.Error("Delete should report whether the key was there")
+	}
+}
+
+func TestStoreIntKeysUpdate(t *testing.T) {
+	s := New(func(p person) int { return p.ID })
+	s.Save(person{ID: 1, Firstname: "Alex"})
+	s.Save(person{ID: 2, Firstname: "Minh"})
+
+	rename := func(p person) (person, error) {
+		p.Firstname = "Lan"
+		return p, nil
+	}
+	if p, err := s.Update(1, rename); err != nil || p.Firstname != "Lan" {
+		t.Errorf("Update: %+v, %v", p, err)
+	}
+	if _, err := s.Update(9, rename); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of a missing key: %v", err)
+	}
+
+	moveTo := func(id int) func(person) (person, error) {
+		return func(p person) (person, error) {
+			p.ID = id
+			return p, nil
+		}
+	}
+	if _, err := s.Update(1, moveTo(2)); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("move onto a taken key: %v", err)
+	}
+	if _, err := s.Update(1, moveTo(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for _, p := range s.List() {
+		ids = append(ids, p.ID)
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []int{2, 3}) {
+		t.Errorf("ids after the move: %v", ids)
+	}
+
+	failed := errors.New("no")
+	if _, err := s.Update(2, func(p person) (person, error) { return p, failed }); err != failed {
+		t.Errorf("fn error: %v", err)
+	}
+	if p, _ := s.Get(2); p.Firstname != "Minh" {
+		t.Errorf("a failed Update changed the value: %+v", p)
+	}
+}
+
+func TestStoreReplace(t *testing.T) {
+	s := New(func(p person) int { return p.ID })
+	s.Save(person{ID: 5, Firstname: "Alex"})
+	s.Save(person{ID: 9, Firstname: "Minh"})
+
+	s.Replace(func(list []person) []person {
+		slices.SortFunc(list, func(a, b person) int { return a.ID - b.ID })
+		for i := range list {
+			list[i].ID = i + 1
+		}
+		return list
+	})
+
+	if p, ok := s.Get(1); !ok || p.Firstname != "Alex" {
+		t.Errorf("Get(1): %+v, %v", p, ok)
+	}
+	if p, ok := s.Get(2); !ok || p.Firstname != "Minh" {
+		t.Errorf("Get(2): %+v, %v", p, ok)
+	}
+	if _, ok := s.Get(5); ok || s.Count() != 2 {
+		t.Errorf("old keys are still there, %d values", s.Count())
+	}
+}
+
+func TestStoreMerge(t *testing.T) {
+	s := New(func(p person) int { return p.ID })
+	s.Save(person{ID: 1, Firstname: "Alex"})
+	s.Save(person{ID: 2, Firstname: "Minh"})
+
+	join := func(into, from person) (person, error) {
+		into.Firstname += " " + from.Firstname
+		return into, nil
+	}
+	if _, err := s.Merge(1, 9, join); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing from: %v", err)
+	}
+	if _, err := s.Merge(9, 1, join); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing into: %v", err)
+	}
+
+	if p, err := s.Merge(1, 2, join); err != nil || p.Firstname != "Alex Minh" {
+		t.Errorf("Merge: %+v, %v", p, err)
+	}
+	if _, ok := s.Get(2); ok || s.Count() != 1 {
+		t.Error("from is still there")
+	}
+}
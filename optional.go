@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Optional tells apart a field left out of a patch, one sent as null and one
+// sent with a value, which a pointer cannot
+type Optional[T any] struct {
+	// Set is true when the field was in the JSON at all
+	Set bool
+	// Null is true when it was sent as null
+	Null  bool
+	Value T
+}
+
+// UnmarshalJSON is only called for fields present in the JSON, null included
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		o.Null = true
+		return nil
+	}
+
+	// unknown fields are rejected like they are by jsonbody.Decode
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(&o.Value)
+}
+
+// nullClears makes an explicit null in a patch clear the field. With
+// PATCH_NULL=ignore a null is treated as if the field was left out.
+var nullClears = true
+
+// applyTo sets *dst to the value, or to the zero value for a null
+func (o Optional[T]) applyTo(dst *T) {
+	switch {
+	case !o.Set:
+	case o.Null:
+		if nullClears {
+			var zero T
+			*dst = zero
+		}
+	default:
+		*dst = o.Value
+	}
+}
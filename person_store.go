@@ -0,0 +1,151 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/alexlevn/go_simplest_restapi/idgen"
+	"github.com/alexlevn/go_simplest_restapi/memstore"
+)
+
+var (
+	// ErrPersonNotFound ...
+	ErrPersonNotFound = errors.New("Person not found")
+	// ErrPersonExists is returned by Create for an id that is already taken
+	ErrPersonExists = errors.New("Person id already exists")
+)
+
+// PersonStore keeps people in the order they were created. It hands out and
+// takes in copies only, so callers can never change a stored person behind
+// the store's back.
+type PersonStore struct {
+	store *memstore.Store[string, storedPerson]
+	ids   idgen.IDGenerator
+	// seq numbers the people in creation order, memstore keeps none
+	seq atomic.Int64
+}
+
+type storedPerson struct {
+	Person
+	seq int64
+}
+
+// NewPersonStore returns an empty store that numbers new people with ids
+func NewPersonStore(ids idgen.IDGenerator) *PersonStore {
+	return &PersonStore{
+		store: memstore.New(func(sp storedPerson) string { return sp.ID }),
+		ids:   ids,
+	}
+}
+
+// clone copies p deeply enough that no pointer is shared with the original
+func (p Person) clone() Person {
+	if p.Address != nil {
+		address := *p.Address
+		p.Address = &address
+	}
+	return p
+}
+
+// Create stores p under a new id, or under p.ID when set. It may return an
+// ErrPersonExists error.
+func (s *PersonStore) Create(p Person) (Person, error) {
+	sp := storedPerson{Person: p.clone(), seq: s.seq.Add(1)}
+
+	if p.ID != "" {
+		if !s.store.Insert(sp) {
+			return Person{}, ErrPersonExists
+		}
+		return sp.clone(), nil
+	}
+
+	// skip ids that clients have already taken
+	sp.ID = s.ids.NewID()
+	for !s.store.Insert(sp) {
+		sp.ID = s.ids.NewID()
+	}
+	return sp.clone(), nil
+}
+
+// Get may return an ErrPersonNotFound error
+func (s *PersonStore) Get(id string) (Person, error) {
+	sp, ok := s.store.Get(id)
+	if !ok {
+		return Person{}, ErrPersonNotFound
+	}
+	return sp.clone(), nil
+}
+
+// Update applies fn to a copy of the person and stores the result in one
+// step, the id cannot be changed. It may return ErrPersonNotFound or
+// whatever fn returns, in which case nothing is stored.
+func (s *PersonStore) Update(id string, fn func(*Person) error) (Person, error) {
+	sp, err := s.store.Update(id, func(sp storedPerson) (storedPerson, error) {
+		updated := sp.clone()
+		if err := fn(&updated); err != nil {
+			return storedPerson{}, err
+		}
+		updated.ID = id
+
+		return storedPerson{Person: updated.clone(), seq: sp.seq}, nil
+	})
+	if errors.Is(err, memstore.ErrNotFound) {
+		return Person{}, ErrPersonNotFound
+	} else if err != nil {
+		return Person{}, err
+	}
+	return sp.clone(), nil
+}
+
+// Delete returns the removed person, it may return an ErrPersonNotFound error
+func (s *PersonStore) Delete(id string) (Person, error) {
+	sp, ok := s.store.Delete(id)
+	if !ok {
+		return Person{}, ErrPersonNotFound
+	}
+	return sp.Person, nil
+}
+
+// List returns a copy of every person in creation order
+func (s *PersonStore) List() []Person {
+	stored := s.store.List()
+	sortBySeq(stored)
+
+	list := make([]Person, len(stored))
+	for i, sp := range stored {
+		list[i] = sp.clone()
+	}
+	return list
+}
+
+func sortBySeq(stored []storedPerson) {
+	slices.SortFunc(stored, func(a, b storedPerson) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+}
+
+// Renumber gives everyone the ids 1..N in creation order and returns the old
+// id of each person mapped to the new one. A sequential generator numbers
+// new people from N+1, other generators are left as they are.
+func (s *PersonStore) Renumber() map[string]string {
+	var mapping map[string]string
+	s.store.Replace(func(stored []storedPerson) []storedPerson {
+		sortBySeq(stored)
+
+		mapping = make(map[string]string, len(stored))
+		for i := range stored {
+			id := strconv.Itoa(i + 1)
+			mapping[stored[i].ID] = id
+			stored[i].ID = id
+		}
+
+		if r, ok := s.ids.(idgen.Resetter); ok {
+			r.Reset(int64(len(stored) + 1))
+		}
+		return stored
+	})
+	return mapping
+}
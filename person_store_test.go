@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/alexlevn/go_simplest_restapi/idgen"
+)
+
+func TestPersonStoreCopies(t *testing.T) {
+	s := NewPersonStore(idgen.NewSequentialIDGen(1))
+	address := &Address{City: "Hue"}
+	p, _ := s.Create(Person{Firstname: "Lan", Address: address})
+
+	// neither the person handed in nor the ones handed out reach the store
+	address.City = "changed"
+	p.Address.City = "changed"
+	got, _ := s.Get(p.ID)
+	got.Address.City = "changed"
+	s.List()[0].Address.City = "changed"
+
+	if got, _ := s.Get(p.ID); got.Address.City != "Hue" {
+		t.Errorf("stored address changed to %q", got.Address.City)
+	}
+
+	if _, err := s.Update(p.ID, func(p *Person) error {
+		p.Address.City = "changed"
+		return errors.New("no")
+	}); err == nil {
+		t.Error("fn error was dropped")
+	}
+	if got, _ := s.Get(p.ID); got.Address.City != "Hue" {
+		t.Errorf("a failed Update changed the address to %q", got.Address.City)
+	}
+
+	for _, err := range []error{
+		func() error { _, err := s.Get("9"); return err }(),
+		func() error { _, err := s.Delete("9"); return err }(),
+		func() error { _, err := s.Update("9", func(*Person) error { return nil }); return err }(),
+	} {
+		if !errors.Is(err, ErrPersonNotFound) {
+			t.Errorf("got %v, want ErrPersonNotFound", err)
+		}
+	}
+}
+
+func TestPersonStoreConcurrent(t *testing.T) {
+	s := NewPersonStore(idgen.NewSequentialIDGen(1))
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				p, err := s.Create(Person{Firstname: fmt.Sprint("w", w), Address: &Address{City: "Hue"}})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				s.Get(p.ID)
+				s.Update(p.ID, func(p *Person) error {
+					p.Address.City = "Hanoi"
+					return nil
+				})
+				for _, q := range s.List() {
+					_ = q.Address.City
+				}
+				if i%2 == 0 {
+					s.Delete(p.ID)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	list := s.List()
+	if len(list) != workers*25 {
+		t.Errorf("%d people left, want %d", len(list), workers*25)
+	}
+	ids := map[string]bool{}
+	for _, p := range list {
+		if ids[p.ID] || p.Address.City != "Hanoi" {
+			t.Errorf("duplicate id or lost update: %+v", p)
+		}
+		ids[p.ID] = true
+	}
+}
+
+func TestPersonStoreOrder(t *testing.T) {
+	s := NewPersonStore(idgen.NewSequentialIDGen(1))
+	for _, p := range []Person{{Firstname: "Alex"}, {ID: "10", Firstname: "Minh"}, {Firstname: "Lan"}, {ID: "0", Firstname: "Hoa"}} {
+		if _, err := s.Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Delete("2")
+	s.Update("1", func(p *Person) error {
+		p.Lastname = "Lee"
+		return nil
+	})
+
+	var got []string
+	for _, p := range s.List() {
+		got = append(got, p.ID+" "+p.Firstname)
+	}
+	want := []string{"1 Alex", "10 Minh", "0 Hoa"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("List: got %v, want creation order %v", got, want)
+	}
+}
+
+func TestPersonStoreRenumberKeepsGenerator(t *testing.T) {
+	seq := idgen.NewSequentialIDGen(1)
+	s := NewPersonStore(seq)
+	for _, p := range []Person{{Firstname: "Alex"}, {ID: "10", Firstname: "Minh"}} {
+		s.Create(p)
+	}
+	s.Renumber()
+	if s.ids != seq {
+		t.Error("Renumber replaced the generator")
+	}
+	if p, _ := s.Create(Person{Firstname: "Lan"}); p.ID != "3" {
+		t.Errorf("after renumbering 2 people: new id %s, want 3", p.ID)
+	}
+
+	uuids := NewPersonStore(idgen.UUIDIDGen{})
+	uuids.Create(Person{Firstname: "Alex"})
+	uuids.Renumber()
+	if p, _ := uuids.Create(Person{Firstname: "Lan"}); len(p.ID) != 36 {
+		t.Errorf("after renumbering: new id %s, want a UUID", p.ID)
+	}
+}
@@ -0,0 +1,37 @@
+// Package textfold compares names ignoring case and accents, so "Jose"
+// matches "José" and "Nguyen" matches "Nguyễn"
+package textfold
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fold lower-cases s and strips its diacritics. Đ has no decomposition in
+// Unicode and is mapped to d by hand.
+func Fold(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		switch r {
+		case 'Đ', 'đ':
+			r = 'd'
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Equal ...
+func Equal(a, b string) bool {
+	return Fold(a) == Fold(b)
+}
+
+// Contains ...
+func Contains(s, substr string) bool {
+	return strings.Contains(Fold(s), Fold(substr))
+}
@@ -0,0 +1,28 @@
+package textfold
+
+import "testing"
+
+func TestFold(t *testing.T) {
+	tests := map[string]string{
+		"José":       "jose",
+		"Nguyễn":     "nguyen",
+		"Đặng Thị":   "dang thi",
+		"ÅNGSTRÖM":   "angstrom",
+		"plain text": "plain text",
+		"":           "",
+	}
+	for in, want := range tests {
+		if got := Fold(in); got != want {
+			t.Errorf("Fold(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEqualContains(t *testing.T) {
+	if !Equal("Jose", "JOSÉ") || Equal("Jose", "Josef") {
+		t.Error("Equal should ignore case and accents only")
+	}
+	if !Contains("Trần Văn Đức", "van duc") || Contains("Trần Văn Đức", "minh") {
+		t.Error("Contains should ignore case and accents only")
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed ui.html
+var uiPage []byte
+
+// uiEndpoint serves a page listing people with a form to add one. It is a
+// demo aid, only registered with DEV=true.
+func uiEndpoint(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexlevn/go_simplest_restapi/jsonbody"
+)
+
+func TestUI(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ui", nil)
+	w := httptest.NewRecorder()
+	newRouter(true, jsonbody.DefaultLimits).ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /ui: got %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type: got %q, want text/html", ct)
+	}
+	if !strings.Contains(w.Body.String(), "/people") {
+		t.Errorf("the page does not fetch /people: %s", w.Body)
+	}
+
+	// without the dev flag the route does not exist
+	if w := serve(http.MethodGet, "/ui", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /ui without DEV: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}